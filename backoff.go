@@ -0,0 +1,55 @@
+package simpleq
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff decides how long to wait before a failed message is retried
+type Backoff interface {
+	Delay(attempt int) time.Duration
+}
+
+// BackoffFunc is an adapter to use ordinary functions as Backoff
+type BackoffFunc func(attempt int) time.Duration
+
+// Delay returns f(attempt)
+func (f BackoffFunc) Delay(attempt int) time.Duration {
+	return f(attempt)
+}
+
+// ConstantBackoff waits the same amount of time before every retry
+func ConstantBackoff(d time.Duration) Backoff {
+	return BackoffFunc(func(_ int) time.Duration {
+		return d
+	})
+}
+
+// LinearBackoff waits d longer before every retry
+func LinearBackoff(d time.Duration) Backoff {
+	return BackoffFunc(func(attempt int) time.Duration {
+		return d * time.Duration(attempt)
+	})
+}
+
+// ExponentialBackoff doubles the wait before every retry starting from base up to max,
+// the actual wait is picked randomly from the upper half so retries of many messages spread out
+func ExponentialBackoff(base time.Duration, max time.Duration) Backoff {
+	return BackoffFunc(func(attempt int) time.Duration {
+		d := max
+
+		if attempt < 1 {
+			attempt = 1
+		}
+
+		if attempt < 63 && base<<(attempt-1) > 0 && base<<(attempt-1) < max {
+			d = base << (attempt - 1)
+		}
+
+		if d <= 0 {
+			return 0
+		}
+
+		return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+	})
+}
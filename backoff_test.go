@@ -0,0 +1,60 @@
+package simpleq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffFunc_Delay(t *testing.T) {
+	t.Run("it_should_call_the_function", func(t *testing.T) {
+		b := BackoffFunc(func(attempt int) time.Duration {
+			return time.Duration(attempt) * time.Hour
+		})
+
+		if got := b.Delay(3); got != 3*time.Hour {
+			t.Errorf("Expected Delay() to return %v, got %v", 3*time.Hour, got)
+		}
+	})
+}
+
+func TestConstantBackoff(t *testing.T) {
+	t.Run("it_should_return_the_same_delay", func(t *testing.T) {
+		b := ConstantBackoff(time.Second)
+
+		for _, attempt := range []int{1, 2, 10} {
+			if got := b.Delay(attempt); got != time.Second {
+				t.Errorf("Expected Delay(%d) to return %v, got %v", attempt, time.Second, got)
+			}
+		}
+	})
+}
+
+func TestLinearBackoff(t *testing.T) {
+	t.Run("it_should_grow_delay_linearly", func(t *testing.T) {
+		b := LinearBackoff(time.Second)
+
+		if got := b.Delay(3); got != 3*time.Second {
+			t.Errorf("Expected Delay() to return %v, got %v", 3*time.Second, got)
+		}
+	})
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff(time.Second, time.Minute)
+
+	t.Run("it_should_double_delay_with_jitter", func(t *testing.T) {
+		for attempt, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second} {
+			if got := b.Delay(attempt); got < max/2 || got > max {
+				t.Errorf("Expected Delay(%d) to be between %v and %v, got %v", attempt, max/2, max, got)
+			}
+		}
+	})
+
+	t.Run("it_should_cap_delay", func(t *testing.T) {
+		for _, attempt := range []int{10, 64, 1000} {
+			if got := b.Delay(attempt); got < 30*time.Second || got > time.Minute {
+				t.Errorf("Expected Delay(%d) to be capped at %v, got %v", attempt, time.Minute, got)
+			}
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package simpleq
+
+import (
+	"context"
+	"fmt"
+)
+
+// defaultClient backs the package level Init() and NewQueue()
+var defaultClient = &Client{}
+
+// ClientOption configures a Client
+type ClientOption func(c *Client)
+
+// WithQueueDefaults sets options applied to every queue created by the client,
+// options given to Client.NewQueue() take precedence
+func WithQueueDefaults(opts ...QueueOption) ClientOption {
+	return func(c *Client) {
+		c.queueOpts = append(c.queueOpts, opts...)
+	}
+}
+
+// NewClient returns a pointer to a new Client instance
+func NewClient(d Driver, l Logger, opts ...ClientOption) *Client {
+	c := &Client{driver: d, logger: l}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Client owns a driver, a logger and the configuration queues are created with,
+// several clients can be used side by side (e.g. to talk to two redis instances)
+type Client struct {
+	driver    Driver
+	logger    Logger
+	queueOpts []QueueOption
+}
+
+// NewQueue returns a pointer to a new Queue instance using the client's driver and logger
+func (c *Client) NewQueue(name string, workers int8, opts ...QueueOption) (*Queue, error) {
+	if err := c.driver.Register(context.Background(), name); err != nil {
+		c.logger.Warn(fmt.Sprintf("Failed to register, %v", err))
+	}
+
+	c.logger.Info(fmt.Sprintf("Initialized queue %s", name))
+
+	q := &Queue{
+		client:  c,
+		Workers: workers,
+		Name:    name,
+		StopC:   make(chan struct{}),
+	}
+
+	for _, opt := range append(c.queueOpts[:len(c.queueOpts):len(c.queueOpts)], opts...) {
+		opt(q)
+	}
+
+	return q, nil
+}
+
+// GetDriver returns the client's driver
+func (c *Client) GetDriver() Driver {
+	return c.driver
+}
+
+// GetLogger returns the client's logger
+func (c *Client) GetLogger() Logger {
+	return c.logger
+}
+
+// GetStats returns statistics of every queue registered with the client's driver
+func (c *Client) GetStats(ctx context.Context) (*Stats, error) {
+	return c.driver.GetStats(ctx)
+}
@@ -0,0 +1,96 @@
+package simpleq
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewClient(t *testing.T) {
+	t.Run("it_should_return_new_client", func(t *testing.T) {
+		d := NewMemoryDriver()
+		lg := &DefaultLogger{}
+
+		expect := &Client{driver: d, logger: lg}
+
+		if got := NewClient(d, lg); !reflect.DeepEqual(expect, got) {
+			t.Errorf("Expected NewClient() to return %v, got %v", expect, got)
+		}
+	})
+}
+
+func TestClient_NewQueue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	d := NewMockDriver(ctrl)
+	lg := NewMockLogger(ctrl)
+
+	qName := "test-queue"
+
+	t.Run("it_should_log_warning_when_it_fails_to_register_queue", func(t *testing.T) {
+		d.EXPECT().Register(gomock.Any(), qName).Return(fmt.Errorf("failed to register")).Times(1)
+		lg.EXPECT().Warn("Failed to register, failed to register").Times(1)
+		lg.EXPECT().Info(gomock.Any()).Times(1)
+
+		if _, err := NewClient(d, lg).NewQueue(qName, 1); err != nil {
+			t.Errorf("Expected NewQueue() to return a new instance, got error %v", err)
+		}
+	})
+
+	t.Run("it_should_return_queue_bound_to_client", func(t *testing.T) {
+		d.EXPECT().Register(gomock.Any(), qName).Times(1)
+		lg.EXPECT().Info(gomock.Any()).Times(1)
+
+		c := NewClient(d, lg)
+
+		if got, _ := c.NewQueue(qName, 2); got.client != c || got.getDriver() != d {
+			t.Errorf("Expected NewQueue() to return queue bound to client")
+		}
+	})
+
+	t.Run("it_should_apply_queue_defaults_before_queue_options", func(t *testing.T) {
+		d.EXPECT().Register(gomock.Any(), qName).Times(2)
+		lg.EXPECT().Info(gomock.Any()).Times(2)
+
+		c := NewClient(d, lg, WithQueueDefaults(WithBackoff(ConstantBackoff(time.Second))))
+
+		if got, _ := c.NewQueue(qName, 1); got.getBackoff().Delay(1) != time.Second {
+			t.Errorf("Expected NewQueue() to apply client defaults")
+		}
+
+		if got, _ := c.NewQueue(qName, 1, WithBackoff(ConstantBackoff(time.Minute))); got.getBackoff().Delay(1) != time.Minute {
+			t.Errorf("Expected NewQueue() options to take precedence over client defaults")
+		}
+	})
+}
+
+func TestClient_isolation(t *testing.T) {
+	t.Run("it_should_keep_queues_of_different_clients_apart", func(t *testing.T) {
+		first := NewClient(NewMemoryDriver(), &DefaultLogger{})
+		second := NewClient(NewMemoryDriver(), &DefaultLogger{})
+
+		q, _ := first.NewQueue("test-queue", 1)
+		_ = q.Push(NewMessage(Content("test-data")))
+
+		if _, err := second.GetDriver().Read(context.Background(), q.getActiveName()); err == nil {
+			t.Errorf("Expected message pushed through first client not to be visible to second")
+		}
+
+		if _, err := first.GetDriver().Read(context.Background(), q.getActiveName()); err != nil {
+			t.Errorf("Expected message to be pushed through first client, got error %v", err)
+		}
+	})
+}
+
+func TestClient_GetStats(t *testing.T) {
+	t.Run("it_should_return_driver_stats", func(t *testing.T) {
+		c := NewClient(NewMemoryDriver(), &DefaultLogger{})
+		_, _ = c.NewQueue("test-queue", 1)
+
+		if got, err := c.GetStats(context.Background()); err != nil || len(*got) != 1 {
+			t.Errorf("Expected GetStats() to return stats of 1 queue, got %v, %v", got, err)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+package simpleq
+
+import (
+	"time"
+)
+
+// DeadLetter is a message which failed max attempts, kept with the reason it failed
+type DeadLetter struct {
+	Message  *Message  `json:"message"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// Attempt is a single failed run of a message
+type Attempt struct {
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
@@ -1,11 +1,152 @@
 package simpleq
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotSupported is returned when the driver lacks an optional capability a queue operation needs
+	ErrNotSupported = errors.New("operation is not supported by the driver")
+	// ErrMessageNotFound is returned when a message is neither pending nor scheduled,
+	// it has either been read already or never existed
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrGroupedMessage is returned when rescheduling a message of an ordered group, which would break the
+	// order of its group. It wraps ErrNotSupported
+	ErrGroupedMessage = fmt.Errorf("%w, grouped messages can not be rescheduled", ErrNotSupported)
+)
+
 // Driver is queue driver interface, can be implemented externally
+//
+// Every method receives the context of the operation, drivers should give up
+// and return ctx.Err() once it is done instead of blocking past its deadline.
+//
+// Read must not discard a message, it should keep it in flight until it is
+// either acknowledged with Ack or handed back to the queue with Nack
 type Driver interface {
-	Write(queue string, d []byte) error
-	Read(queue string) ([]byte, error)
-	SetProcessed(queue string) error
-	Register(queue string) error
-	SetFailed(queue string, taskID string) error
-	GetStats() (*Stats, error)
+	Write(ctx context.Context, queue string, d []byte) error
+	Read(ctx context.Context, queue string) ([]byte, error)
+	Ack(ctx context.Context, queue string, d []byte) error
+	Nack(ctx context.Context, queue string, d []byte) error
+	SetProcessed(ctx context.Context, queue string) error
+	Register(ctx context.Context, queue string) error
+	SetFailed(ctx context.Context, queue string, taskID string) error
+	GetStats(ctx context.Context) (*Stats, error)
+}
+
+// ExpiryCounter is implemented by drivers able to count messages skipped as they expired, reported as Stat.Expired
+type ExpiryCounter interface {
+	SetExpired(ctx context.Context, queue string) error
+}
+
+// BatchWriter is implemented by drivers able to write many messages in a single round trip,
+// the returned errors match ds by index and are nil for written messages
+type BatchWriter interface {
+	WriteBatch(ctx context.Context, queue string, ds [][]byte) []error
+}
+
+// BlockingReader is implemented by drivers able to wait for a message to be written,
+// ReadBlocking returns redis.Nil once timeout passes without one and ErrNotSupported when
+// the driver is configured in a way it can not wait, queues poll with Read() instead
+type BlockingReader interface {
+	ReadBlocking(ctx context.Context, queue string, timeout time.Duration) ([]byte, error)
+}
+
+// PriorityReader is implemented by drivers able to read from the first of many queues holding
+// a message in a single call, queues are tried in the given order and the index of the one read
+// from is returned along with the message, redis.Nil is returned when every queue is empty
+type PriorityReader interface {
+	ReadFirst(ctx context.Context, queues []string) (int, []byte, error)
+}
+
+// InFlightReaper is implemented by drivers keeping in-flight messages per consumer, Heartbeat keeps the consumer
+// of the driver alive for ttl and Reap returns messages left in flight by consumers of queue whose heartbeat
+// expired back to the queue, so messages of a crashed consumer are not lost when it never comes back
+type InFlightReaper interface {
+	Heartbeat(ctx context.Context, queue string, ttl time.Duration) error
+	Reap(ctx context.Context, queue string) (int64, error)
+}
+
+// Scheduler is implemented by drivers able to hold messages back until a given time
+// Promote moves every message due until the given time into the active queue
+type Scheduler interface {
+	Schedule(ctx context.Context, queue string, d []byte, at time.Time) error
+	Promote(ctx context.Context, queue string, until time.Time) (int64, error)
+}
+
+// Rescheduler is implemented by drivers able to find a pending or scheduled message by its ID,
+// both operations must return ErrMessageNotFound once the message has been read. Delete returns the deleted message,
+// messages pending in groups and tenants (see GroupStore and TenantStore) are found too, Reschedule returns
+// ErrGroupedMessage for grouped ones
+type Rescheduler interface {
+	Reschedule(ctx context.Context, queue string, id string, at time.Time) error
+	Delete(ctx context.Context, queue string, id string) ([]byte, error)
+}
+
+// DeadLetterStore is implemented by drivers able to keep messages which failed max attempts,
+// GetDeadLetter and DeleteDeadLetter must return ErrMessageNotFound for unknown IDs
+type DeadLetterStore interface {
+	AddDeadLetter(ctx context.Context, queue string, id string, d []byte) error
+	GetDeadLetters(ctx context.Context, queue string) ([][]byte, error)
+	GetDeadLetter(ctx context.Context, queue string, id string) ([]byte, error)
+	DeleteDeadLetter(ctx context.Context, queue string, id string) error
+}
+
+// Deduplicator is implemented by drivers able to remember idempotency keys for a while,
+// Claim returns false when key has been claimed within window already and
+// Release forgets a claimed key so it can be claimed again
+type Deduplicator interface {
+	Claim(ctx context.Context, queue string, key string, window time.Duration) (bool, error)
+	Release(ctx context.Context, queue string, key string) error
+}
+
+// UniqueLocker is implemented by drivers able to hold locks of unique jobs,
+// Lock takes the lock of key for owner until ttl passes, it returns false when another owner holds it
+// and refreshes it when owner does. Unlock releases the lock only when owner holds it
+type UniqueLocker interface {
+	Lock(ctx context.Context, queue string, key string, owner string, ttl time.Duration) (bool, error)
+	Unlock(ctx context.Context, queue string, key string, owner string) error
+}
+
+// RateLimiter is implemented by drivers able to keep a token bucket shared by every process,
+// Take takes a token of a bucket refilled with rate tokens per second holding up to burst tokens,
+// it returns how long to wait before trying again when there is none
+type RateLimiter interface {
+	Take(ctx context.Context, queue string, rate float64, burst int) (time.Duration, error)
+}
+
+// Semaphore is implemented by drivers able to keep a counting semaphore shared by every process,
+// AcquireSlot takes one of limit slots for holder leased until ttl passes, returns false when none is free
+// and renews the lease when holder holds a slot already. ReleaseSlot frees the slot of holder
+type Semaphore interface {
+	AcquireSlot(ctx context.Context, queue string, holder string, limit int, ttl time.Duration) (bool, error)
+	ReleaseSlot(ctx context.Context, queue string, holder string) error
+}
+
+// GroupStore is implemented by drivers able to keep ordered message groups, messages of a group are read
+// first in first out and the group is locked while one of them is in flight, until it is acknowledged or
+// its lease passes, so they are never read concurrently. ReadGroup reads from ready groups round robin and
+// returns redis.Nil when there is none. RenewGroup extends the lease of a group while d is its in-flight message.
+// NackGroup replaces an in-flight message by retry and keeps its group locked until at, retry is read first
+// from the group then
+type GroupStore interface {
+	WriteGroup(ctx context.Context, queue string, group string, d []byte) error
+	ReadGroup(ctx context.Context, queue string, lease time.Duration) (string, []byte, error)
+	RenewGroup(ctx context.Context, queue string, group string, d []byte, lease time.Duration) (bool, error)
+	AckGroup(ctx context.Context, queue string, group string, d []byte) error
+	NackGroup(ctx context.Context, queue string, group string, d []byte, retry []byte, at time.Time) error
+}
+
+// TenantStore is implemented by drivers able to keep pending messages of each tenant apart and read them
+// fairly, ReadTenant takes turns between tenants having pending messages reading up to their weight (1 when
+// missing from weights) in a row and returns redis.Nil when there is none. Read messages are kept in flight
+// like Read does and acknowledged with Ack, NackTenant returns one to the head of its tenant. Promote moves
+// due messages of tenants to the tail of their tenant. GetStats reports pending messages of each tenant
+// as Stat.TenantBacklogs
+type TenantStore interface {
+	WriteTenant(ctx context.Context, queue string, tenant string, d []byte) error
+	ReadTenant(ctx context.Context, queue string, weights map[string]int) (string, []byte, error)
+	NackTenant(ctx context.Context, queue string, tenant string, d []byte) error
 }
@@ -5,7 +5,9 @@
 package simpleq
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -33,88 +35,861 @@ func (m *MockDriver) EXPECT() *MockDriverMockRecorder {
 	return m.recorder
 }
 
+// Ack mocks base method.
+func (m *MockDriver) Ack(ctx context.Context, queue string, d []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ack", ctx, queue, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ack indicates an expected call of Ack.
+func (mr *MockDriverMockRecorder) Ack(ctx, queue, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ack", reflect.TypeOf((*MockDriver)(nil).Ack), ctx, queue, d)
+}
+
 // GetStats mocks base method.
-func (m *MockDriver) GetStats() (*Stats, error) {
+func (m *MockDriver) GetStats(ctx context.Context) (*Stats, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetStats")
+	ret := m.ctrl.Call(m, "GetStats", ctx)
 	ret0, _ := ret[0].(*Stats)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetStats indicates an expected call of GetStats.
-func (mr *MockDriverMockRecorder) GetStats() *gomock.Call {
+func (mr *MockDriverMockRecorder) GetStats(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockDriver)(nil).GetStats), ctx)
+}
+
+// Nack mocks base method.
+func (m *MockDriver) Nack(ctx context.Context, queue string, d []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Nack", ctx, queue, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Nack indicates an expected call of Nack.
+func (mr *MockDriverMockRecorder) Nack(ctx, queue, d interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockDriver)(nil).GetStats))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Nack", reflect.TypeOf((*MockDriver)(nil).Nack), ctx, queue, d)
 }
 
 // Read mocks base method.
-func (m *MockDriver) Read(queue string) ([]byte, error) {
+func (m *MockDriver) Read(ctx context.Context, queue string) ([]byte, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Read", queue)
+	ret := m.ctrl.Call(m, "Read", ctx, queue)
 	ret0, _ := ret[0].([]byte)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Read indicates an expected call of Read.
-func (mr *MockDriverMockRecorder) Read(queue interface{}) *gomock.Call {
+func (mr *MockDriverMockRecorder) Read(ctx, queue interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockDriver)(nil).Read), queue)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockDriver)(nil).Read), ctx, queue)
 }
 
 // Register mocks base method.
-func (m *MockDriver) Register(queue string) error {
+func (m *MockDriver) Register(ctx context.Context, queue string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Register", queue)
+	ret := m.ctrl.Call(m, "Register", ctx, queue)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Register indicates an expected call of Register.
-func (mr *MockDriverMockRecorder) Register(queue interface{}) *gomock.Call {
+func (mr *MockDriverMockRecorder) Register(ctx, queue interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockDriver)(nil).Register), queue)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockDriver)(nil).Register), ctx, queue)
 }
 
 // SetFailed mocks base method.
-func (m *MockDriver) SetFailed(queue, taskID string) error {
+func (m *MockDriver) SetFailed(ctx context.Context, queue, taskID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetFailed", queue, taskID)
+	ret := m.ctrl.Call(m, "SetFailed", ctx, queue, taskID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SetFailed indicates an expected call of SetFailed.
-func (mr *MockDriverMockRecorder) SetFailed(queue, taskID interface{}) *gomock.Call {
+func (mr *MockDriverMockRecorder) SetFailed(ctx, queue, taskID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFailed", reflect.TypeOf((*MockDriver)(nil).SetFailed), queue, taskID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFailed", reflect.TypeOf((*MockDriver)(nil).SetFailed), ctx, queue, taskID)
 }
 
 // SetProcessed mocks base method.
-func (m *MockDriver) SetProcessed(queue string) error {
+func (m *MockDriver) SetProcessed(ctx context.Context, queue string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetProcessed", queue)
+	ret := m.ctrl.Call(m, "SetProcessed", ctx, queue)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SetProcessed indicates an expected call of SetProcessed.
-func (mr *MockDriverMockRecorder) SetProcessed(queue interface{}) *gomock.Call {
+func (mr *MockDriverMockRecorder) SetProcessed(ctx, queue interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProcessed", reflect.TypeOf((*MockDriver)(nil).SetProcessed), queue)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProcessed", reflect.TypeOf((*MockDriver)(nil).SetProcessed), ctx, queue)
 }
 
 // Write mocks base method.
-func (m *MockDriver) Write(queue string, d []byte) error {
+func (m *MockDriver) Write(ctx context.Context, queue string, d []byte) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Write", queue, d)
+	ret := m.ctrl.Call(m, "Write", ctx, queue, d)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Write indicates an expected call of Write.
-func (mr *MockDriverMockRecorder) Write(queue, d interface{}) *gomock.Call {
+func (mr *MockDriverMockRecorder) Write(ctx, queue, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockDriver)(nil).Write), ctx, queue, d)
+}
+
+// MockExpiryCounter is a mock of ExpiryCounter interface.
+type MockExpiryCounter struct {
+	ctrl     *gomock.Controller
+	recorder *MockExpiryCounterMockRecorder
+}
+
+// MockExpiryCounterMockRecorder is the mock recorder for MockExpiryCounter.
+type MockExpiryCounterMockRecorder struct {
+	mock *MockExpiryCounter
+}
+
+// NewMockExpiryCounter creates a new mock instance.
+func NewMockExpiryCounter(ctrl *gomock.Controller) *MockExpiryCounter {
+	mock := &MockExpiryCounter{ctrl: ctrl}
+	mock.recorder = &MockExpiryCounterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockExpiryCounter) EXPECT() *MockExpiryCounterMockRecorder {
+	return m.recorder
+}
+
+// SetExpired mocks base method.
+func (m *MockExpiryCounter) SetExpired(ctx context.Context, queue string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetExpired", ctx, queue)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetExpired indicates an expected call of SetExpired.
+func (mr *MockExpiryCounterMockRecorder) SetExpired(ctx, queue interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetExpired", reflect.TypeOf((*MockExpiryCounter)(nil).SetExpired), ctx, queue)
+}
+
+// MockBatchWriter is a mock of BatchWriter interface.
+type MockBatchWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockBatchWriterMockRecorder
+}
+
+// MockBatchWriterMockRecorder is the mock recorder for MockBatchWriter.
+type MockBatchWriterMockRecorder struct {
+	mock *MockBatchWriter
+}
+
+// NewMockBatchWriter creates a new mock instance.
+func NewMockBatchWriter(ctrl *gomock.Controller) *MockBatchWriter {
+	mock := &MockBatchWriter{ctrl: ctrl}
+	mock.recorder = &MockBatchWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBatchWriter) EXPECT() *MockBatchWriterMockRecorder {
+	return m.recorder
+}
+
+// WriteBatch mocks base method.
+func (m *MockBatchWriter) WriteBatch(ctx context.Context, queue string, ds [][]byte) []error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteBatch", ctx, queue, ds)
+	ret0, _ := ret[0].([]error)
+	return ret0
+}
+
+// WriteBatch indicates an expected call of WriteBatch.
+func (mr *MockBatchWriterMockRecorder) WriteBatch(ctx, queue, ds interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteBatch", reflect.TypeOf((*MockBatchWriter)(nil).WriteBatch), ctx, queue, ds)
+}
+
+// MockBlockingReader is a mock of BlockingReader interface.
+type MockBlockingReader struct {
+	ctrl     *gomock.Controller
+	recorder *MockBlockingReaderMockRecorder
+}
+
+// MockBlockingReaderMockRecorder is the mock recorder for MockBlockingReader.
+type MockBlockingReaderMockRecorder struct {
+	mock *MockBlockingReader
+}
+
+// NewMockBlockingReader creates a new mock instance.
+func NewMockBlockingReader(ctrl *gomock.Controller) *MockBlockingReader {
+	mock := &MockBlockingReader{ctrl: ctrl}
+	mock.recorder = &MockBlockingReaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBlockingReader) EXPECT() *MockBlockingReaderMockRecorder {
+	return m.recorder
+}
+
+// ReadBlocking mocks base method.
+func (m *MockBlockingReader) ReadBlocking(ctx context.Context, queue string, timeout time.Duration) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadBlocking", ctx, queue, timeout)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadBlocking indicates an expected call of ReadBlocking.
+func (mr *MockBlockingReaderMockRecorder) ReadBlocking(ctx, queue, timeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadBlocking", reflect.TypeOf((*MockBlockingReader)(nil).ReadBlocking), ctx, queue, timeout)
+}
+
+// MockPriorityReader is a mock of PriorityReader interface.
+type MockPriorityReader struct {
+	ctrl     *gomock.Controller
+	recorder *MockPriorityReaderMockRecorder
+}
+
+// MockPriorityReaderMockRecorder is the mock recorder for MockPriorityReader.
+type MockPriorityReaderMockRecorder struct {
+	mock *MockPriorityReader
+}
+
+// NewMockPriorityReader creates a new mock instance.
+func NewMockPriorityReader(ctrl *gomock.Controller) *MockPriorityReader {
+	mock := &MockPriorityReader{ctrl: ctrl}
+	mock.recorder = &MockPriorityReaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPriorityReader) EXPECT() *MockPriorityReaderMockRecorder {
+	return m.recorder
+}
+
+// ReadFirst mocks base method.
+func (m *MockPriorityReader) ReadFirst(ctx context.Context, queues []string) (int, []byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadFirst", ctx, queues)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReadFirst indicates an expected call of ReadFirst.
+func (mr *MockPriorityReaderMockRecorder) ReadFirst(ctx, queues interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadFirst", reflect.TypeOf((*MockPriorityReader)(nil).ReadFirst), ctx, queues)
+}
+
+// MockInFlightReaper is a mock of InFlightReaper interface.
+type MockInFlightReaper struct {
+	ctrl     *gomock.Controller
+	recorder *MockInFlightReaperMockRecorder
+}
+
+// MockInFlightReaperMockRecorder is the mock recorder for MockInFlightReaper.
+type MockInFlightReaperMockRecorder struct {
+	mock *MockInFlightReaper
+}
+
+// NewMockInFlightReaper creates a new mock instance.
+func NewMockInFlightReaper(ctrl *gomock.Controller) *MockInFlightReaper {
+	mock := &MockInFlightReaper{ctrl: ctrl}
+	mock.recorder = &MockInFlightReaperMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockInFlightReaper) EXPECT() *MockInFlightReaperMockRecorder {
+	return m.recorder
+}
+
+// Heartbeat mocks base method.
+func (m *MockInFlightReaper) Heartbeat(ctx context.Context, queue string, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Heartbeat", ctx, queue, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Heartbeat indicates an expected call of Heartbeat.
+func (mr *MockInFlightReaperMockRecorder) Heartbeat(ctx, queue, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Heartbeat", reflect.TypeOf((*MockInFlightReaper)(nil).Heartbeat), ctx, queue, ttl)
+}
+
+// Reap mocks base method.
+func (m *MockInFlightReaper) Reap(ctx context.Context, queue string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reap", ctx, queue)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reap indicates an expected call of Reap.
+func (mr *MockInFlightReaperMockRecorder) Reap(ctx, queue interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reap", reflect.TypeOf((*MockInFlightReaper)(nil).Reap), ctx, queue)
+}
+
+// MockScheduler is a mock of Scheduler interface.
+type MockScheduler struct {
+	ctrl     *gomock.Controller
+	recorder *MockSchedulerMockRecorder
+}
+
+// MockSchedulerMockRecorder is the mock recorder for MockScheduler.
+type MockSchedulerMockRecorder struct {
+	mock *MockScheduler
+}
+
+// NewMockScheduler creates a new mock instance.
+func NewMockScheduler(ctrl *gomock.Controller) *MockScheduler {
+	mock := &MockScheduler{ctrl: ctrl}
+	mock.recorder = &MockSchedulerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScheduler) EXPECT() *MockSchedulerMockRecorder {
+	return m.recorder
+}
+
+// Promote mocks base method.
+func (m *MockScheduler) Promote(ctx context.Context, queue string, until time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Promote", ctx, queue, until)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Promote indicates an expected call of Promote.
+func (mr *MockSchedulerMockRecorder) Promote(ctx, queue, until interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Promote", reflect.TypeOf((*MockScheduler)(nil).Promote), ctx, queue, until)
+}
+
+// Schedule mocks base method.
+func (m *MockScheduler) Schedule(ctx context.Context, queue string, d []byte, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Schedule", ctx, queue, d, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Schedule indicates an expected call of Schedule.
+func (mr *MockSchedulerMockRecorder) Schedule(ctx, queue, d, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Schedule", reflect.TypeOf((*MockScheduler)(nil).Schedule), ctx, queue, d, at)
+}
+
+// MockRescheduler is a mock of Rescheduler interface.
+type MockRescheduler struct {
+	ctrl     *gomock.Controller
+	recorder *MockReschedulerMockRecorder
+}
+
+// MockReschedulerMockRecorder is the mock recorder for MockRescheduler.
+type MockReschedulerMockRecorder struct {
+	mock *MockRescheduler
+}
+
+// NewMockRescheduler creates a new mock instance.
+func NewMockRescheduler(ctrl *gomock.Controller) *MockRescheduler {
+	mock := &MockRescheduler{ctrl: ctrl}
+	mock.recorder = &MockReschedulerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRescheduler) EXPECT() *MockReschedulerMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockRescheduler) Delete(ctx context.Context, queue, id string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, queue, id)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockReschedulerMockRecorder) Delete(ctx, queue, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRescheduler)(nil).Delete), ctx, queue, id)
+}
+
+// Reschedule mocks base method.
+func (m *MockRescheduler) Reschedule(ctx context.Context, queue, id string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reschedule", ctx, queue, id, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reschedule indicates an expected call of Reschedule.
+func (mr *MockReschedulerMockRecorder) Reschedule(ctx, queue, id, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reschedule", reflect.TypeOf((*MockRescheduler)(nil).Reschedule), ctx, queue, id, at)
+}
+
+// MockDeadLetterStore is a mock of DeadLetterStore interface.
+type MockDeadLetterStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeadLetterStoreMockRecorder
+}
+
+// MockDeadLetterStoreMockRecorder is the mock recorder for MockDeadLetterStore.
+type MockDeadLetterStoreMockRecorder struct {
+	mock *MockDeadLetterStore
+}
+
+// NewMockDeadLetterStore creates a new mock instance.
+func NewMockDeadLetterStore(ctrl *gomock.Controller) *MockDeadLetterStore {
+	mock := &MockDeadLetterStore{ctrl: ctrl}
+	mock.recorder = &MockDeadLetterStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeadLetterStore) EXPECT() *MockDeadLetterStoreMockRecorder {
+	return m.recorder
+}
+
+// AddDeadLetter mocks base method.
+func (m *MockDeadLetterStore) AddDeadLetter(ctx context.Context, queue, id string, d []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddDeadLetter", ctx, queue, id, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddDeadLetter indicates an expected call of AddDeadLetter.
+func (mr *MockDeadLetterStoreMockRecorder) AddDeadLetter(ctx, queue, id, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddDeadLetter", reflect.TypeOf((*MockDeadLetterStore)(nil).AddDeadLetter), ctx, queue, id, d)
+}
+
+// DeleteDeadLetter mocks base method.
+func (m *MockDeadLetterStore) DeleteDeadLetter(ctx context.Context, queue, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDeadLetter", ctx, queue, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteDeadLetter indicates an expected call of DeleteDeadLetter.
+func (mr *MockDeadLetterStoreMockRecorder) DeleteDeadLetter(ctx, queue, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDeadLetter", reflect.TypeOf((*MockDeadLetterStore)(nil).DeleteDeadLetter), ctx, queue, id)
+}
+
+// GetDeadLetter mocks base method.
+func (m *MockDeadLetterStore) GetDeadLetter(ctx context.Context, queue, id string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeadLetter", ctx, queue, id)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeadLetter indicates an expected call of GetDeadLetter.
+func (mr *MockDeadLetterStoreMockRecorder) GetDeadLetter(ctx, queue, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeadLetter", reflect.TypeOf((*MockDeadLetterStore)(nil).GetDeadLetter), ctx, queue, id)
+}
+
+// GetDeadLetters mocks base method.
+func (m *MockDeadLetterStore) GetDeadLetters(ctx context.Context, queue string) ([][]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeadLetters", ctx, queue)
+	ret0, _ := ret[0].([][]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeadLetters indicates an expected call of GetDeadLetters.
+func (mr *MockDeadLetterStoreMockRecorder) GetDeadLetters(ctx, queue interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeadLetters", reflect.TypeOf((*MockDeadLetterStore)(nil).GetDeadLetters), ctx, queue)
+}
+
+// MockDeduplicator is a mock of Deduplicator interface.
+type MockDeduplicator struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeduplicatorMockRecorder
+}
+
+// MockDeduplicatorMockRecorder is the mock recorder for MockDeduplicator.
+type MockDeduplicatorMockRecorder struct {
+	mock *MockDeduplicator
+}
+
+// NewMockDeduplicator creates a new mock instance.
+func NewMockDeduplicator(ctrl *gomock.Controller) *MockDeduplicator {
+	mock := &MockDeduplicator{ctrl: ctrl}
+	mock.recorder = &MockDeduplicatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeduplicator) EXPECT() *MockDeduplicatorMockRecorder {
+	return m.recorder
+}
+
+// Claim mocks base method.
+func (m *MockDeduplicator) Claim(ctx context.Context, queue, key string, window time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Claim", ctx, queue, key, window)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Claim indicates an expected call of Claim.
+func (mr *MockDeduplicatorMockRecorder) Claim(ctx, queue, key, window interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Claim", reflect.TypeOf((*MockDeduplicator)(nil).Claim), ctx, queue, key, window)
+}
+
+// Release mocks base method.
+func (m *MockDeduplicator) Release(ctx context.Context, queue, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Release", ctx, queue, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Release indicates an expected call of Release.
+func (mr *MockDeduplicatorMockRecorder) Release(ctx, queue, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Release", reflect.TypeOf((*MockDeduplicator)(nil).Release), ctx, queue, key)
+}
+
+// MockUniqueLocker is a mock of UniqueLocker interface.
+type MockUniqueLocker struct {
+	ctrl     *gomock.Controller
+	recorder *MockUniqueLockerMockRecorder
+}
+
+// MockUniqueLockerMockRecorder is the mock recorder for MockUniqueLocker.
+type MockUniqueLockerMockRecorder struct {
+	mock *MockUniqueLocker
+}
+
+// NewMockUniqueLocker creates a new mock instance.
+func NewMockUniqueLocker(ctrl *gomock.Controller) *MockUniqueLocker {
+	mock := &MockUniqueLocker{ctrl: ctrl}
+	mock.recorder = &MockUniqueLockerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUniqueLocker) EXPECT() *MockUniqueLockerMockRecorder {
+	return m.recorder
+}
+
+// Lock mocks base method.
+func (m *MockUniqueLocker) Lock(ctx context.Context, queue, key, owner string, ttl time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lock", ctx, queue, key, owner, ttl)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Lock indicates an expected call of Lock.
+func (mr *MockUniqueLockerMockRecorder) Lock(ctx, queue, key, owner, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lock", reflect.TypeOf((*MockUniqueLocker)(nil).Lock), ctx, queue, key, owner, ttl)
+}
+
+// Unlock mocks base method.
+func (m *MockUniqueLocker) Unlock(ctx context.Context, queue, key, owner string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unlock", ctx, queue, key, owner)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unlock indicates an expected call of Unlock.
+func (mr *MockUniqueLockerMockRecorder) Unlock(ctx, queue, key, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unlock", reflect.TypeOf((*MockUniqueLocker)(nil).Unlock), ctx, queue, key, owner)
+}
+
+// MockRateLimiter is a mock of RateLimiter interface.
+type MockRateLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimiterMockRecorder
+}
+
+// MockRateLimiterMockRecorder is the mock recorder for MockRateLimiter.
+type MockRateLimiterMockRecorder struct {
+	mock *MockRateLimiter
+}
+
+// NewMockRateLimiter creates a new mock instance.
+func NewMockRateLimiter(ctrl *gomock.Controller) *MockRateLimiter {
+	mock := &MockRateLimiter{ctrl: ctrl}
+	mock.recorder = &MockRateLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimiter) EXPECT() *MockRateLimiterMockRecorder {
+	return m.recorder
+}
+
+// Take mocks base method.
+func (m *MockRateLimiter) Take(ctx context.Context, queue string, rate float64, burst int) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Take", ctx, queue, rate, burst)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Take indicates an expected call of Take.
+func (mr *MockRateLimiterMockRecorder) Take(ctx, queue, rate, burst interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Take", reflect.TypeOf((*MockRateLimiter)(nil).Take), ctx, queue, rate, burst)
+}
+
+// MockSemaphore is a mock of Semaphore interface.
+type MockSemaphore struct {
+	ctrl     *gomock.Controller
+	recorder *MockSemaphoreMockRecorder
+}
+
+// MockSemaphoreMockRecorder is the mock recorder for MockSemaphore.
+type MockSemaphoreMockRecorder struct {
+	mock *MockSemaphore
+}
+
+// NewMockSemaphore creates a new mock instance.
+func NewMockSemaphore(ctrl *gomock.Controller) *MockSemaphore {
+	mock := &MockSemaphore{ctrl: ctrl}
+	mock.recorder = &MockSemaphoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSemaphore) EXPECT() *MockSemaphoreMockRecorder {
+	return m.recorder
+}
+
+// AcquireSlot mocks base method.
+func (m *MockSemaphore) AcquireSlot(ctx context.Context, queue, holder string, limit int, ttl time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AcquireSlot", ctx, queue, holder, limit, ttl)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcquireSlot indicates an expected call of AcquireSlot.
+func (mr *MockSemaphoreMockRecorder) AcquireSlot(ctx, queue, holder, limit, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AcquireSlot", reflect.TypeOf((*MockSemaphore)(nil).AcquireSlot), ctx, queue, holder, limit, ttl)
+}
+
+// ReleaseSlot mocks base method.
+func (m *MockSemaphore) ReleaseSlot(ctx context.Context, queue, holder string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseSlot", ctx, queue, holder)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseSlot indicates an expected call of ReleaseSlot.
+func (mr *MockSemaphoreMockRecorder) ReleaseSlot(ctx, queue, holder interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseSlot", reflect.TypeOf((*MockSemaphore)(nil).ReleaseSlot), ctx, queue, holder)
+}
+
+// MockGroupStore is a mock of GroupStore interface.
+type MockGroupStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockGroupStoreMockRecorder
+}
+
+// MockGroupStoreMockRecorder is the mock recorder for MockGroupStore.
+type MockGroupStoreMockRecorder struct {
+	mock *MockGroupStore
+}
+
+// NewMockGroupStore creates a new mock instance.
+func NewMockGroupStore(ctrl *gomock.Controller) *MockGroupStore {
+	mock := &MockGroupStore{ctrl: ctrl}
+	mock.recorder = &MockGroupStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockGroupStore) EXPECT() *MockGroupStoreMockRecorder {
+	return m.recorder
+}
+
+// AckGroup mocks base method.
+func (m *MockGroupStore) AckGroup(ctx context.Context, queue, group string, d []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AckGroup", ctx, queue, group, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AckGroup indicates an expected call of AckGroup.
+func (mr *MockGroupStoreMockRecorder) AckGroup(ctx, queue, group, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AckGroup", reflect.TypeOf((*MockGroupStore)(nil).AckGroup), ctx, queue, group, d)
+}
+
+// NackGroup mocks base method.
+func (m *MockGroupStore) NackGroup(ctx context.Context, queue, group string, d, retry []byte, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NackGroup", ctx, queue, group, d, retry, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NackGroup indicates an expected call of NackGroup.
+func (mr *MockGroupStoreMockRecorder) NackGroup(ctx, queue, group, d, retry, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NackGroup", reflect.TypeOf((*MockGroupStore)(nil).NackGroup), ctx, queue, group, d, retry, at)
+}
+
+// ReadGroup mocks base method.
+func (m *MockGroupStore) ReadGroup(ctx context.Context, queue string, lease time.Duration) (string, []byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadGroup", ctx, queue, lease)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReadGroup indicates an expected call of ReadGroup.
+func (mr *MockGroupStoreMockRecorder) ReadGroup(ctx, queue, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadGroup", reflect.TypeOf((*MockGroupStore)(nil).ReadGroup), ctx, queue, lease)
+}
+
+// RenewGroup mocks base method.
+func (m *MockGroupStore) RenewGroup(ctx context.Context, queue, group string, d []byte, lease time.Duration) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenewGroup", ctx, queue, group, d, lease)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenewGroup indicates an expected call of RenewGroup.
+func (mr *MockGroupStoreMockRecorder) RenewGroup(ctx, queue, group, d, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenewGroup", reflect.TypeOf((*MockGroupStore)(nil).RenewGroup), ctx, queue, group, d, lease)
+}
+
+// WriteGroup mocks base method.
+func (m *MockGroupStore) WriteGroup(ctx context.Context, queue, group string, d []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteGroup", ctx, queue, group, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteGroup indicates an expected call of WriteGroup.
+func (mr *MockGroupStoreMockRecorder) WriteGroup(ctx, queue, group, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteGroup", reflect.TypeOf((*MockGroupStore)(nil).WriteGroup), ctx, queue, group, d)
+}
+
+// MockTenantStore is a mock of TenantStore interface.
+type MockTenantStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockTenantStoreMockRecorder
+}
+
+// MockTenantStoreMockRecorder is the mock recorder for MockTenantStore.
+type MockTenantStoreMockRecorder struct {
+	mock *MockTenantStore
+}
+
+// NewMockTenantStore creates a new mock instance.
+func NewMockTenantStore(ctrl *gomock.Controller) *MockTenantStore {
+	mock := &MockTenantStore{ctrl: ctrl}
+	mock.recorder = &MockTenantStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTenantStore) EXPECT() *MockTenantStoreMockRecorder {
+	return m.recorder
+}
+
+// NackTenant mocks base method.
+func (m *MockTenantStore) NackTenant(ctx context.Context, queue, tenant string, d []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NackTenant", ctx, queue, tenant, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// NackTenant indicates an expected call of NackTenant.
+func (mr *MockTenantStoreMockRecorder) NackTenant(ctx, queue, tenant, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NackTenant", reflect.TypeOf((*MockTenantStore)(nil).NackTenant), ctx, queue, tenant, d)
+}
+
+// ReadTenant mocks base method.
+func (m *MockTenantStore) ReadTenant(ctx context.Context, queue string, weights map[string]int) (string, []byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadTenant", ctx, queue, weights)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReadTenant indicates an expected call of ReadTenant.
+func (mr *MockTenantStoreMockRecorder) ReadTenant(ctx, queue, weights interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadTenant", reflect.TypeOf((*MockTenantStore)(nil).ReadTenant), ctx, queue, weights)
+}
+
+// WriteTenant mocks base method.
+func (m *MockTenantStore) WriteTenant(ctx context.Context, queue, tenant string, d []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteTenant", ctx, queue, tenant, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteTenant indicates an expected call of WriteTenant.
+func (mr *MockTenantStoreMockRecorder) WriteTenant(ctx, queue, tenant, d interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockDriver)(nil).Write), queue, d)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteTenant", reflect.TypeOf((*MockTenantStore)(nil).WriteTenant), ctx, queue, tenant, d)
 }
@@ -3,6 +3,7 @@ module github.com/omermevlut/simpleq
 go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/golang/mock v1.4.4
 	github.com/google/uuid v1.2.0
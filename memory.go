@@ -0,0 +1,993 @@
+package simpleq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// claimSweepInterval is how often expired idempotency claims are deleted
+const claimSweepInterval = time.Minute
+
+// NewMemoryDriver initializes and returns a pointer to a new in-memory driver instance
+func NewMemoryDriver() *MemoryDriver {
+	return &MemoryDriver{
+		lists:     map[string][][]byte{},
+		sets:      map[string]map[string]struct{}{},
+		counters:  map[string]int64{},
+		scheduled: map[string][]scheduledMessage{},
+		hashes:    map[string]map[string][]byte{},
+		claims:    map[string]time.Time{},
+		locks:     map[string]uniqueLock{},
+		buckets:   map[string]tokenBucket{},
+		leases:    map[string]map[string]time.Time{},
+		backlogs:  map[string]map[string]int64{},
+		notify:    make(chan struct{}),
+	}
+}
+
+// MemoryDriver is a concurrency safe queue driver keeping everything in process memory,
+// messages are read first in first out and are lost once the process exits.
+// It uses the same keys as RedisQueueDriver does
+type MemoryDriver struct {
+	mu sync.Mutex
+
+	lists     map[string][][]byte
+	sets      map[string]map[string]struct{}
+	counters  map[string]int64
+	scheduled map[string][]scheduledMessage
+	hashes    map[string]map[string][]byte
+	// claims holds claimed idempotency keys until they expire
+	claims map[string]time.Time
+	// claimsSwept is when expired claims were last deleted
+	claimsSwept time.Time
+	// locks holds locks of unique jobs until they expire
+	locks map[string]uniqueLock
+	// buckets holds token buckets of rate limited queues
+	buckets map[string]tokenBucket
+	// leases holds semaphore slots by holder until their lease expires
+	leases map[string]map[string]time.Time
+	// backlogs holds pending message counts by tenant
+	backlogs map[string]map[string]int64
+	// notify is closed and replaced whenever a message becomes readable
+	notify chan struct{}
+}
+
+type uniqueLock struct {
+	owner string
+	until time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+type scheduledMessage struct {
+	at time.Time
+	d  []byte
+}
+
+// Write writes to active queue to be executed immediately
+func (md *MemoryDriver) Write(ctx context.Context, queue string, d []byte) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	md.push(fmt.Sprintf("%s:active", queue), d)
+	md.signal()
+
+	return nil
+}
+
+// WriteBatch writes many messages to active queue at once
+func (md *MemoryDriver) WriteBatch(ctx context.Context, queue string, ds [][]byte) []error {
+	if err := md.lock(ctx); err != nil {
+		return batchErrors(len(ds), err)
+	}
+	defer md.mu.Unlock()
+
+	for _, d := range ds {
+		md.push(fmt.Sprintf("%s:active", queue), d)
+	}
+
+	md.signal()
+
+	return make([]error, len(ds))
+}
+
+// Read moves the oldest message of queue in flight and returns it,
+// redis.Nil is returned when the queue is empty to match the redis drivers
+func (md *MemoryDriver) Read(ctx context.Context, queue string) ([]byte, error) {
+	if err := md.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer md.mu.Unlock()
+
+	if d, ok := md.pop(queue); ok {
+		return d, nil
+	}
+
+	return nil, redis.Nil
+}
+
+// ReadFirst reads the oldest message of the first non empty queue
+func (md *MemoryDriver) ReadFirst(ctx context.Context, queues []string) (int, []byte, error) {
+	if err := md.lock(ctx); err != nil {
+		return 0, nil, err
+	}
+	defer md.mu.Unlock()
+
+	for i, queue := range queues {
+		if d, ok := md.pop(queue); ok {
+			return i, d, nil
+		}
+	}
+
+	return 0, nil, redis.Nil
+}
+
+// ReadBlocking waits up to timeout for a message to be written to queue
+func (md *MemoryDriver) ReadBlocking(ctx context.Context, queue string, timeout time.Duration) ([]byte, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		if err := md.lock(ctx); err != nil {
+			return nil, err
+		}
+
+		d, ok := md.pop(queue)
+		notify := md.notify
+		md.mu.Unlock()
+
+		if ok {
+			return d, nil
+		}
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return nil, redis.Nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Ack removes a message from the in-flight list once it has been handled
+func (md *MemoryDriver) Ack(ctx context.Context, queue string, d []byte) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	md.remove(fmt.Sprintf("%s:in-flight", queue), d)
+
+	return nil
+}
+
+// Nack returns an in-flight message to the head of the queue
+func (md *MemoryDriver) Nack(ctx context.Context, queue string, d []byte) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	if md.remove(fmt.Sprintf("%s:in-flight", queue), d) {
+		key := fmt.Sprintf("%s:active", queue)
+		md.lists[key] = append([][]byte{d}, md.lists[key]...)
+		md.signal()
+	}
+
+	return nil
+}
+
+// Schedule holds a message back until at
+func (md *MemoryDriver) Schedule(ctx context.Context, queue string, d []byte, at time.Time) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	md.schedule(queue, d, at)
+
+	return nil
+}
+
+// Promote moves messages scheduled until a given time into the active queue, messages of tenants back to their tenant
+func (md *MemoryDriver) Promote(ctx context.Context, queue string, until time.Time) (int64, error) {
+	if err := md.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer md.mu.Unlock()
+
+	key := scheduledKey(queue)
+	ms := md.scheduled[key]
+	n := sort.Search(len(ms), func(i int) bool { return ms[i].at.After(until) })
+
+	for _, m := range ms[:n] {
+		var msg Message
+
+		if err := json.Unmarshal(m.d, &msg); err == nil && msg.GetTenantKey() != "" {
+			md.push(tenantKey(queue, msg.GetTenantKey()), m.d)
+
+			if md.addBacklog(queue, msg.GetTenantKey(), 1) == 1 {
+				md.push(tenantsReadyKey(queue), []byte(msg.GetTenantKey()))
+			}
+
+			continue
+		}
+
+		md.push(fmt.Sprintf("%s:active", queue), m.d)
+	}
+
+	md.scheduled[key] = ms[n:]
+
+	if n > 0 {
+		md.signal()
+	}
+
+	return int64(n), nil
+}
+
+// Reschedule moves a pending or scheduled message to be executed at a given time, ErrGroupedMessage
+// is returned for messages of groups
+func (md *MemoryDriver) Reschedule(ctx context.Context, queue string, id string, at time.Time) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	d, ok := md.take(queue, id)
+
+	if !ok {
+		if _, _, grouped := md.findGroup(queue, id); grouped {
+			return ErrGroupedMessage
+		}
+
+		return ErrMessageNotFound
+	}
+
+	md.schedule(queue, d, at)
+
+	return nil
+}
+
+// Delete removes a pending, scheduled or grouped message and returns it
+func (md *MemoryDriver) Delete(ctx context.Context, queue string, id string) ([]byte, error) {
+	if err := md.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer md.mu.Unlock()
+
+	d, ok := md.take(queue, id)
+
+	if !ok {
+		d, ok = md.takeGroup(queue, id)
+	}
+
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+
+	return d, nil
+}
+
+// SetProcessed increments processed amount
+func (md *MemoryDriver) SetProcessed(ctx context.Context, queue string) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	md.counters[fmt.Sprintf("%s:processed", queue)]++
+
+	return nil
+}
+
+// SetFailed increments fail data
+func (md *MemoryDriver) SetFailed(ctx context.Context, queue string, taskID string) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	md.add(fmt.Sprintf("%s:failed", queue), taskID)
+
+	return nil
+}
+
+// SetExpired increments expired amount
+func (md *MemoryDriver) SetExpired(ctx context.Context, queue string) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	md.counters[fmt.Sprintf("%s:expired", queue)]++
+
+	return nil
+}
+
+// Claim claims an idempotency key for window unless it is claimed already
+func (md *MemoryDriver) Claim(ctx context.Context, queue string, key string, window time.Duration) (bool, error) {
+	if err := md.lock(ctx); err != nil {
+		return false, err
+	}
+	defer md.mu.Unlock()
+
+	k := fmt.Sprintf("%s:idempotency:%s", queue, key)
+	now := time.Now()
+
+	// keys which are never claimed again would be kept forever otherwise
+	if now.Sub(md.claimsSwept) >= claimSweepInterval {
+		for claimed, until := range md.claims {
+			if !now.Before(until) {
+				delete(md.claims, claimed)
+			}
+		}
+
+		md.claimsSwept = now
+	}
+
+	if until, ok := md.claims[k]; ok && now.Before(until) {
+		return false, nil
+	}
+
+	md.claims[k] = now.Add(window)
+
+	return true, nil
+}
+
+// Release forgets a claimed idempotency key
+func (md *MemoryDriver) Release(ctx context.Context, queue string, key string) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	delete(md.claims, fmt.Sprintf("%s:idempotency:%s", queue, key))
+
+	return nil
+}
+
+// Lock takes or refreshes the lock of a unique job unless another owner holds it
+func (md *MemoryDriver) Lock(ctx context.Context, queue string, key string, owner string, ttl time.Duration) (bool, error) {
+	if err := md.lock(ctx); err != nil {
+		return false, err
+	}
+	defer md.mu.Unlock()
+
+	k := fmt.Sprintf("%s:unique:%s", queue, key)
+	now := time.Now()
+
+	if l, ok := md.locks[k]; ok && l.owner != owner && now.Before(l.until) {
+		return false, nil
+	}
+
+	md.locks[k] = uniqueLock{owner: owner, until: now.Add(ttl)}
+
+	return true, nil
+}
+
+// Unlock releases the lock of a unique job held by owner
+func (md *MemoryDriver) Unlock(ctx context.Context, queue string, key string, owner string) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	k := fmt.Sprintf("%s:unique:%s", queue, key)
+
+	if md.locks[k].owner == owner {
+		delete(md.locks, k)
+	}
+
+	return nil
+}
+
+// Take takes a token of the queue's token bucket
+func (md *MemoryDriver) Take(ctx context.Context, queue string, rate float64, burst int) (time.Duration, error) {
+	if err := md.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer md.mu.Unlock()
+
+	key := fmt.Sprintf("%s:rate-limit", queue)
+	now := time.Now()
+	b, ok := md.buckets[key]
+
+	if !ok {
+		b = tokenBucket{tokens: float64(burst), at: now}
+	}
+
+	if now.After(b.at) {
+		b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.at).Seconds()*rate)
+		b.at = now
+	}
+
+	var wait time.Duration
+
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		wait = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+
+	md.buckets[key] = b
+
+	return wait, nil
+}
+
+// AcquireSlot takes or renews a slot of the queue's semaphore
+func (md *MemoryDriver) AcquireSlot(ctx context.Context, queue string, holder string, limit int, ttl time.Duration) (bool, error) {
+	if err := md.lock(ctx); err != nil {
+		return false, err
+	}
+	defer md.mu.Unlock()
+
+	key := fmt.Sprintf("%s:semaphore", queue)
+	now := time.Now()
+
+	if md.leases[key] == nil {
+		md.leases[key] = map[string]time.Time{}
+	}
+
+	for h, until := range md.leases[key] {
+		if !now.Before(until) {
+			delete(md.leases[key], h)
+		}
+	}
+
+	if _, ok := md.leases[key][holder]; !ok && len(md.leases[key]) >= limit {
+		return false, nil
+	}
+
+	md.leases[key][holder] = now.Add(ttl)
+
+	return true, nil
+}
+
+// ReleaseSlot frees the semaphore slot of holder
+func (md *MemoryDriver) ReleaseSlot(ctx context.Context, queue string, holder string) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	delete(md.leases[fmt.Sprintf("%s:semaphore", queue)], holder)
+
+	return nil
+}
+
+// WriteGroup writes to the tail of a message group
+func (md *MemoryDriver) WriteGroup(ctx context.Context, queue string, group string, d []byte) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	key := groupKey(queue, group)
+	md.push(key, d)
+
+	if _, locked := md.leases[groupsLockedKey(queue)][group]; len(md.lists[key]) == 1 && !locked {
+		md.push(groupsReadyKey(queue), []byte(group))
+	}
+
+	return nil
+}
+
+// ReadGroup moves the oldest message of the next ready group in flight and locks the group until lease passes
+func (md *MemoryDriver) ReadGroup(ctx context.Context, queue string, lease time.Duration) (string, []byte, error) {
+	if err := md.lock(ctx); err != nil {
+		return "", nil, err
+	}
+	defer md.mu.Unlock()
+
+	now := time.Now()
+	ready := groupsReadyKey(queue)
+	locked := groupsLockedKey(queue)
+
+	if md.leases[locked] == nil {
+		md.leases[locked] = map[string]time.Time{}
+	}
+
+	// groups whose lease passed get their in-flight message back at their head
+	for group, until := range md.leases[locked] {
+		if now.Before(until) {
+			continue
+		}
+
+		key := groupKey(queue, group)
+		md.lists[key] = append(md.lists[key+":in-flight"], md.lists[key]...)
+		delete(md.lists, key+":in-flight")
+		delete(md.leases[locked], group)
+
+		if len(md.lists[key]) > 0 {
+			md.lists[ready] = append([][]byte{[]byte(group)}, md.lists[ready]...)
+		}
+	}
+
+	for len(md.lists[ready]) > 0 {
+		group := string(md.lists[ready][0])
+		md.lists[ready] = md.lists[ready][1:]
+		key := groupKey(queue, group)
+
+		if len(md.lists[key]) == 0 {
+			continue
+		}
+
+		d := md.lists[key][0]
+		md.lists[key] = md.lists[key][1:]
+		md.push(key+":in-flight", d)
+		md.leases[locked][group] = now.Add(lease)
+
+		return group, d, nil
+	}
+
+	return "", nil, redis.Nil
+}
+
+// RenewGroup keeps a group locked until lease passes while d is its in-flight message
+func (md *MemoryDriver) RenewGroup(ctx context.Context, queue string, group string, d []byte, lease time.Duration) (bool, error) {
+	if err := md.lock(ctx); err != nil {
+		return false, err
+	}
+	defer md.mu.Unlock()
+
+	for _, m := range md.lists[groupKey(queue, group)+":in-flight"] {
+		if bytes.Equal(m, d) {
+			md.leases[groupsLockedKey(queue)][group] = time.Now().Add(lease)
+
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// AckGroup removes a message of a group from in flight and unlocks the group
+func (md *MemoryDriver) AckGroup(ctx context.Context, queue string, group string, d []byte) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	key := groupKey(queue, group)
+
+	if !md.remove(key+":in-flight", d) {
+		return nil
+	}
+
+	delete(md.leases[groupsLockedKey(queue)], group)
+
+	if len(md.lists[key]) > 0 {
+		md.push(groupsReadyKey(queue), []byte(group))
+	}
+
+	return nil
+}
+
+// NackGroup replaces an in-flight message of a group by retry, the group stays locked until at
+func (md *MemoryDriver) NackGroup(ctx context.Context, queue string, group string, d []byte, retry []byte, at time.Time) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	key := groupKey(queue, group)
+
+	if md.remove(key+":in-flight", d) {
+		md.push(key+":in-flight", retry)
+		md.leases[groupsLockedKey(queue)][group] = at
+	}
+
+	return nil
+}
+
+// WriteTenant writes to the tail of a tenant
+func (md *MemoryDriver) WriteTenant(ctx context.Context, queue string, tenant string, d []byte) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	md.push(tenantKey(queue, tenant), d)
+
+	if md.addBacklog(queue, tenant, 1) == 1 {
+		md.push(tenantsReadyKey(queue), []byte(tenant))
+	}
+
+	return nil
+}
+
+// ReadTenant moves the oldest message of the next ready tenant in flight,
+// tenants are read up to their weight in a row before the next one
+func (md *MemoryDriver) ReadTenant(ctx context.Context, queue string, weights map[string]int) (string, []byte, error) {
+	if err := md.lock(ctx); err != nil {
+		return "", nil, err
+	}
+	defer md.mu.Unlock()
+
+	ready := tenantsReadyKey(queue)
+	served := tenantsServedKey(queue)
+
+	if len(md.lists[ready]) == 0 {
+		return "", nil, redis.Nil
+	}
+
+	tenant := string(md.lists[ready][0])
+	key := tenantKey(queue, tenant)
+	d := md.lists[key][0]
+	md.lists[key] = md.lists[key][1:]
+	md.push(fmt.Sprintf("%s:in-flight", queue), d)
+
+	weight, ok := weights[tenant]
+
+	if !ok {
+		weight = 1
+	}
+
+	md.counters[served]++
+
+	switch {
+	case md.addBacklog(queue, tenant, -1) == 0:
+		md.lists[ready] = md.lists[ready][1:]
+		delete(md.counters, served)
+	case md.counters[served] >= int64(weight):
+		md.lists[ready] = append(md.lists[ready][1:], []byte(tenant))
+		delete(md.counters, served)
+	}
+
+	return tenant, d, nil
+}
+
+// NackTenant returns an in-flight message to the head of its tenant
+func (md *MemoryDriver) NackTenant(ctx context.Context, queue string, tenant string, d []byte) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	if !md.remove(fmt.Sprintf("%s:in-flight", queue), d) {
+		return nil
+	}
+
+	key := tenantKey(queue, tenant)
+	md.lists[key] = append([][]byte{d}, md.lists[key]...)
+
+	if md.addBacklog(queue, tenant, 1) == 1 {
+		ready := tenantsReadyKey(queue)
+		md.lists[ready] = append([][]byte{[]byte(tenant)}, md.lists[ready]...)
+	}
+
+	return nil
+}
+
+// AddDeadLetter keeps a message which failed max attempts
+func (md *MemoryDriver) AddDeadLetter(ctx context.Context, queue string, id string, d []byte) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	key := fmt.Sprintf("%s:dead-letters", queue)
+
+	if md.hashes[key] == nil {
+		md.hashes[key] = map[string][]byte{}
+	}
+
+	md.hashes[key][id] = append([]byte(nil), d...)
+
+	return nil
+}
+
+// GetDeadLetters returns every message which failed max attempts
+func (md *MemoryDriver) GetDeadLetters(ctx context.Context, queue string) ([][]byte, error) {
+	if err := md.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer md.mu.Unlock()
+
+	var ds [][]byte
+
+	for _, d := range md.hashes[fmt.Sprintf("%s:dead-letters", queue)] {
+		ds = append(ds, d)
+	}
+
+	return ds, nil
+}
+
+// GetDeadLetter returns a single message which failed max attempts
+func (md *MemoryDriver) GetDeadLetter(ctx context.Context, queue string, id string) ([]byte, error) {
+	if err := md.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer md.mu.Unlock()
+
+	d, ok := md.hashes[fmt.Sprintf("%s:dead-letters", queue)][id]
+
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+
+	return d, nil
+}
+
+// DeleteDeadLetter removes a message which failed max attempts
+func (md *MemoryDriver) DeleteDeadLetter(ctx context.Context, queue string, id string) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	key := fmt.Sprintf("%s:dead-letters", queue)
+
+	if _, ok := md.hashes[key][id]; !ok {
+		return ErrMessageNotFound
+	}
+
+	delete(md.hashes[key], id)
+
+	return nil
+}
+
+// Register registers a new queue (should not be additive)
+func (md *MemoryDriver) Register(ctx context.Context, queue string) error {
+	if err := md.lock(ctx); err != nil {
+		return err
+	}
+	defer md.mu.Unlock()
+
+	md.add(fmt.Sprintf("%s:queue-list", queuePrefix), queue)
+
+	return nil
+}
+
+// GetStats returns available queue statistics
+func (md *MemoryDriver) GetStats(ctx context.Context) (*Stats, error) {
+	if err := md.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer md.mu.Unlock()
+
+	var stats = Stats{}
+
+	for q := range md.sets[fmt.Sprintf("%s:queue-list", queuePrefix)] {
+		failed := md.members(fmt.Sprintf("%s:%s:failed", queuePrefix, q))
+
+		stats[q] = Stat{
+			Processed:      md.counters[fmt.Sprintf("%s:%s:processed", queuePrefix, q)],
+			Expired:        md.counters[fmt.Sprintf("%s:%s:expired", queuePrefix, q)],
+			Failed:         len(failed),
+			FailedIDs:      failed,
+			TenantBacklogs: md.tenantBacklogs(fmt.Sprintf("%s:active:%s", queuePrefix, q)),
+		}
+	}
+
+	return &stats, nil
+}
+
+// lock takes the driver's mutex unless ctx is already done
+func (md *MemoryDriver) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	md.mu.Lock()
+
+	return nil
+}
+
+// pop moves the oldest message of queue in flight
+func (md *MemoryDriver) pop(queue string) ([]byte, bool) {
+	key := fmt.Sprintf("%s:active", queue)
+
+	if len(md.lists[key]) == 0 {
+		return nil, false
+	}
+
+	d := md.lists[key][0]
+	md.lists[key] = md.lists[key][1:]
+	md.push(fmt.Sprintf("%s:in-flight", queue), d)
+
+	return d, true
+}
+
+// addBacklog adds n to the pending message count of tenant and returns it
+func (md *MemoryDriver) addBacklog(queue string, tenant string, n int64) int64 {
+	key := tenantsKey(queue)
+
+	if md.backlogs[key] == nil {
+		md.backlogs[key] = map[string]int64{}
+	}
+
+	md.backlogs[key][tenant] += n
+	left := md.backlogs[key][tenant]
+
+	if left <= 0 {
+		delete(md.backlogs[key], tenant)
+	}
+
+	return left
+}
+
+// tenantBacklogs sums pending messages of each tenant over the priority levels of an active queue
+func (md *MemoryDriver) tenantBacklogs(active string) map[string]int64 {
+	var backlogs map[string]int64
+
+	for key, counts := range md.backlogs {
+		if !isTenantsKey(active, key) {
+			continue
+		}
+
+		for tenant, n := range counts {
+			if backlogs == nil {
+				backlogs = map[string]int64{}
+			}
+
+			backlogs[tenant] += n
+		}
+	}
+
+	return backlogs
+}
+
+// signal wakes up every blocked reader
+func (md *MemoryDriver) signal() {
+	close(md.notify)
+	md.notify = make(chan struct{})
+}
+
+func (md *MemoryDriver) push(key string, d []byte) {
+	md.lists[key] = append(md.lists[key], append([]byte(nil), d...))
+}
+
+func (md *MemoryDriver) remove(key string, d []byte) bool {
+	for i, m := range md.lists[key] {
+		if bytes.Equal(m, d) {
+			md.lists[key] = append(md.lists[key][:i:i], md.lists[key][i+1:]...)
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (md *MemoryDriver) add(key string, member string) {
+	if md.sets[key] == nil {
+		md.sets[key] = map[string]struct{}{}
+	}
+
+	md.sets[key][member] = struct{}{}
+}
+
+func (md *MemoryDriver) members(key string) []string {
+	m := make([]string, 0, len(md.sets[key]))
+
+	for k := range md.sets[key] {
+		m = append(m, k)
+	}
+
+	sort.Strings(m)
+
+	return m
+}
+
+func (md *MemoryDriver) schedule(queue string, d []byte, at time.Time) {
+	key := scheduledKey(queue)
+	ms := md.scheduled[key]
+	i := sort.Search(len(ms), func(i int) bool { return ms[i].at.After(at) })
+
+	ms = append(ms, scheduledMessage{})
+	copy(ms[i+1:], ms[i:])
+	ms[i] = scheduledMessage{at: at, d: append([]byte(nil), d...)}
+	md.scheduled[key] = ms
+}
+
+// take removes a scheduled or pending message by its ID
+func (md *MemoryDriver) take(queue string, id string) ([]byte, bool) {
+	key := scheduledKey(queue)
+
+	for i, m := range md.scheduled[key] {
+		if messageID(m.d) == id {
+			md.scheduled[key] = append(md.scheduled[key][:i:i], md.scheduled[key][i+1:]...)
+
+			return m.d, true
+		}
+	}
+
+	key = fmt.Sprintf("%s:active", queue)
+
+	for i, d := range md.lists[key] {
+		if messageID(d) == id {
+			md.lists[key] = append(md.lists[key][:i:i], md.lists[key][i+1:]...)
+
+			return d, true
+		}
+	}
+
+	return md.takeTenant(queue, id)
+}
+
+// takeTenant removes a pending message of a tenant, the tenant leaves the ready tenants once it has none left
+func (md *MemoryDriver) takeTenant(queue string, id string) ([]byte, bool) {
+	prefix := tenantKey(queue, "")
+
+	for key, ds := range md.lists {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		for i, d := range ds {
+			if messageID(d) != id {
+				continue
+			}
+
+			tenant := strings.TrimPrefix(key, prefix)
+			md.lists[key] = append(ds[:i:i], ds[i+1:]...)
+
+			if md.addBacklog(queue, tenant, -1) == 0 {
+				ready := tenantsReadyKey(queue)
+
+				if len(md.lists[ready]) > 0 && string(md.lists[ready][0]) == tenant {
+					delete(md.counters, tenantsServedKey(queue))
+				}
+
+				md.remove(ready, []byte(tenant))
+			}
+
+			return d, true
+		}
+	}
+
+	return nil, false
+}
+
+// takeGroup removes a pending message of a group, the group leaves the ready groups once it is empty
+func (md *MemoryDriver) takeGroup(queue string, id string) ([]byte, bool) {
+	group, i, ok := md.findGroup(queue, id)
+
+	if !ok {
+		return nil, false
+	}
+
+	key := groupKey(queue, group)
+	d := md.lists[key][i]
+	md.lists[key] = append(md.lists[key][:i:i], md.lists[key][i+1:]...)
+
+	if len(md.lists[key]) == 0 {
+		md.remove(groupsReadyKey(queue), []byte(group))
+	}
+
+	return d, true
+}
+
+// findGroup returns the group of a pending message and its position in the group
+func (md *MemoryDriver) findGroup(queue string, id string) (string, int, bool) {
+	prefix := groupKey(queue, "")
+
+	for key, ds := range md.lists {
+		if !strings.HasPrefix(key, prefix) || strings.HasSuffix(key, ":in-flight") {
+			continue
+		}
+
+		for i, d := range ds {
+			if messageID(d) == id {
+				return strings.TrimPrefix(key, prefix), i, true
+			}
+		}
+	}
+
+	return "", 0, false
+}
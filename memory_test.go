@@ -0,0 +1,604 @@
+package simpleq
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type recordingTask struct {
+	done chan struct{}
+}
+
+func (rt *recordingTask) Run(c Context) error {
+	rt.done <- struct{}{}
+
+	return nil
+}
+
+func (rt *recordingTask) Fail(err error) {}
+
+func TestMemoryDriver_Read(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_nil_error_when_queue_is_empty", func(t *testing.T) {
+		if _, err := d.Read(context.Background(), queue); err != redis.Nil {
+			t.Errorf("Expected Read() to return %v, got %v", redis.Nil, err)
+		}
+	})
+
+	t.Run("it_should_read_messages_in_order", func(t *testing.T) {
+		for _, m := range []string{"a", "b", "a"} {
+			_ = d.Write(context.Background(), queue, []byte(m))
+		}
+
+		for _, expect := range []string{"a", "b", "a"} {
+			if got, err := d.Read(context.Background(), queue); err != nil || string(got) != expect {
+				t.Errorf("Expected Read() to return %s, got %s, %v", expect, got, err)
+			}
+		}
+	})
+
+	t.Run("it_should_keep_read_messages_in_flight", func(t *testing.T) {
+		if got := len(d.lists[queue+":in-flight"]); got != 3 {
+			t.Errorf("Expected 3 in-flight messages, got %v", got)
+		}
+	})
+}
+
+func TestMemoryDriver_ReadBlocking(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_nil_error_once_timeout_passes", func(t *testing.T) {
+		if _, err := d.ReadBlocking(context.Background(), queue, 10*time.Millisecond); err != redis.Nil {
+			t.Errorf("Expected ReadBlocking() to return %v, got %v", redis.Nil, err)
+		}
+	})
+
+	t.Run("it_should_wait_for_message_to_be_written", func(t *testing.T) {
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = d.Write(context.Background(), queue, []byte("test-data"))
+		}()
+
+		if got, err := d.ReadBlocking(context.Background(), queue, time.Second); err != nil || string(got) != "test-data" {
+			t.Errorf("Expected ReadBlocking() to return test-data, got %s, %v", got, err)
+		}
+	})
+}
+
+func TestMemoryDriver_ReadFirst(t *testing.T) {
+	d := NewMemoryDriver()
+	queues := []string{"simple-queue:data:active:test-queue:priority:1", "simple-queue:data:active:test-queue"}
+
+	t.Run("it_should_read_from_first_non_empty_queue", func(t *testing.T) {
+		_ = d.Write(context.Background(), queues[1], []byte("low"))
+		_ = d.Write(context.Background(), queues[0], []byte("high"))
+
+		for i, expect := range []string{"high", "low"} {
+			if n, got, err := d.ReadFirst(context.Background(), queues); err != nil || n != i || string(got) != expect {
+				t.Errorf("Expected ReadFirst() to return %v, %s, got %v, %s, %v", i, expect, n, got, err)
+			}
+		}
+
+		if _, _, err := d.ReadFirst(context.Background(), queues); err != redis.Nil {
+			t.Errorf("Expected ReadFirst() to return %v, got %v", redis.Nil, err)
+		}
+	})
+}
+
+func TestMemoryDriver_WriteBatch(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_write_every_message_in_order", func(t *testing.T) {
+		if errs := d.WriteBatch(context.Background(), queue, [][]byte{[]byte("a"), []byte("b")}); !reflect.DeepEqual(errs, []error{nil, nil}) {
+			t.Errorf("Expected WriteBatch() not to return errors, got %v", errs)
+		}
+
+		for _, expect := range []string{"a", "b"} {
+			if got, _ := d.Read(context.Background(), queue); string(got) != expect {
+				t.Errorf("Expected Read() to return %s, got %s", expect, got)
+			}
+		}
+	})
+}
+
+func TestMemoryDriver_Ack(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_remove_message_from_in_flight_list", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte("test-data"))
+		m, _ := d.Read(context.Background(), queue)
+		_ = d.Ack(context.Background(), queue, m)
+
+		if got := len(d.lists[queue+":in-flight"]); got != 0 {
+			t.Errorf("Expected in-flight list to be empty, got %v messages", got)
+		}
+	})
+}
+
+func TestMemoryDriver_Nack(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_message_to_the_head_of_the_queue", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte("a"))
+		_ = d.Write(context.Background(), queue, []byte("b"))
+
+		m, _ := d.Read(context.Background(), queue)
+		_ = d.Nack(context.Background(), queue, m)
+
+		if got, _ := d.Read(context.Background(), queue); string(got) != "a" {
+			t.Errorf("Expected Read() to return a, got %s", got)
+		}
+	})
+}
+
+func TestMemoryDriver_GetStats(t *testing.T) {
+	d := NewMemoryDriver()
+
+	t.Run("it_should_return_queue_stats", func(t *testing.T) {
+		_ = d.Register(context.Background(), "test-queue")
+		_ = d.SetProcessed(context.Background(), "simple-queue:data:test-queue")
+		_ = d.SetFailed(context.Background(), "simple-queue:data:test-queue", "test-id")
+		_ = d.SetExpired(context.Background(), "simple-queue:data:test-queue")
+
+		expect := &Stats{"test-queue": Stat{Processed: 1, Expired: 1, Failed: 1, FailedIDs: []string{"test-id"}}}
+
+		if got, err := d.GetStats(context.Background()); err != nil || !reflect.DeepEqual(expect, got) {
+			t.Errorf("Expected GetStats() to return %v, got %v, %v", expect, got, err)
+		}
+	})
+}
+
+func TestMemoryDriver_OnExec(t *testing.T) {
+	client := NewClient(NewMemoryDriver(), &DefaultLogger{})
+
+	t.Run("it_should_run_pushed_messages", func(t *testing.T) {
+		q, _ := client.NewQueue("test-queue", 1)
+		task := &recordingTask{done: make(chan struct{}, 2)}
+
+		_ = q.Push(NewMessage(Content("a")))
+		_ = q.Push(NewMessage(Content("b")))
+
+		q.OnExec(task)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-task.done:
+			case <-time.After(time.Second):
+				t.Fatalf("Expected pushed messages to be run")
+			}
+		}
+
+		_ = q.Stop(context.Background())
+
+		if stats, _ := q.getDriver().GetStats(context.Background()); (*stats)["test-queue"].Processed != 2 {
+			t.Errorf("Expected 2 processed messages, got %v", (*stats)["test-queue"].Processed)
+		}
+	})
+}
+
+func TestMemoryDriver_Promote(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+	now := time.Now()
+
+	t.Run("it_should_move_due_messages_to_queue_in_schedule_order", func(t *testing.T) {
+		_ = d.Schedule(context.Background(), queue, []byte("later"), now.Add(time.Hour))
+		_ = d.Schedule(context.Background(), queue, []byte("second"), now.Add(-time.Second))
+		_ = d.Schedule(context.Background(), queue, []byte("first"), now.Add(-time.Minute))
+
+		if n, err := d.Promote(context.Background(), queue, now); err != nil || n != 2 {
+			t.Errorf("Expected Promote() to promote 2 messages, got %v, %v", n, err)
+		}
+
+		for _, expect := range []string{"first", "second"} {
+			if got, _ := d.Read(context.Background(), queue); string(got) != expect {
+				t.Errorf("Expected Read() to return %s, got %s", expect, got)
+			}
+		}
+
+		if _, err := d.Read(context.Background(), queue); err != redis.Nil {
+			t.Errorf("Expected Read() to return %v, got %v", redis.Nil, err)
+		}
+	})
+}
+
+func TestMemoryDriver_Reschedule(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+	now := time.Now()
+
+	t.Run("it_should_reschedule_pending_message", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte(`{"id":"pending"}`))
+
+		if err := d.Reschedule(context.Background(), queue, "pending", now.Add(time.Hour)); err != nil {
+			t.Errorf("Expected Reschedule() not to return error, got %v", err)
+		}
+
+		if _, err := d.Read(context.Background(), queue); err != redis.Nil {
+			t.Errorf("Expected rescheduled message to leave the queue, got %v", err)
+		}
+
+		if n, _ := d.Promote(context.Background(), queue, now.Add(time.Hour)); n != 1 {
+			t.Errorf("Expected rescheduled message to be promoted")
+		}
+	})
+
+	t.Run("it_should_return_error_when_message_has_been_read", func(t *testing.T) {
+		_, _ = d.Read(context.Background(), queue)
+
+		if err := d.Reschedule(context.Background(), queue, "pending", now); err != ErrMessageNotFound {
+			t.Errorf("Expected Reschedule() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+	})
+}
+
+func TestMemoryDriver_context(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_error_when_context_is_done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := d.Write(ctx, queue, []byte("test-data")); err != context.Canceled {
+			t.Errorf("Expected Write() to return error %v, got %v", context.Canceled, err)
+		}
+
+		if _, err := d.Read(context.Background(), queue); err != redis.Nil {
+			t.Errorf("Expected message not to be written, got %v", err)
+		}
+	})
+}
+
+func TestMemoryDriver_Delete(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_delete_scheduled_message", func(t *testing.T) {
+		_ = d.Schedule(context.Background(), queue, []byte(`{"id":"scheduled"}`), time.Now())
+
+		if _, err := d.Delete(context.Background(), queue, "scheduled"); err != nil {
+			t.Errorf("Expected Delete() not to return error, got %v", err)
+		}
+
+		if _, err := d.Delete(context.Background(), queue, "scheduled"); err != ErrMessageNotFound {
+			t.Errorf("Expected Delete() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+	})
+
+	t.Run("it_should_delete_pending_grouped_message", func(t *testing.T) {
+		m := []byte(`{"id":"grouped","group_key":"a"}`)
+		_ = d.WriteGroup(context.Background(), queue, "a", m)
+
+		if err := d.Reschedule(context.Background(), queue, "grouped", time.Now()); !errors.Is(err, ErrGroupedMessage) {
+			t.Errorf("Expected Reschedule() to return error %v, got %v", ErrGroupedMessage, err)
+		}
+
+		if got, err := d.Delete(context.Background(), queue, "grouped"); err != nil || string(got) != string(m) {
+			t.Errorf("Expected Delete() to return deleted message, got %s, %v", got, err)
+		}
+
+		if _, _, err := d.ReadGroup(context.Background(), queue, time.Hour); err != redis.Nil {
+			t.Errorf("Expected ReadGroup() to return redis.Nil once grouped message was deleted, got %v", err)
+		}
+	})
+
+	t.Run("it_should_delete_pending_tenant_message", func(t *testing.T) {
+		m := []byte(`{"id":"tenanted","tenant_key":"a"}`)
+		_ = d.WriteTenant(context.Background(), queue, "a", m)
+
+		if got, err := d.Delete(context.Background(), queue, "tenanted"); err != nil || string(got) != string(m) {
+			t.Errorf("Expected Delete() to return deleted message, got %s, %v", got, err)
+		}
+
+		if n := len(d.lists[tenantsReadyKey(queue)]); n != 0 || len(d.backlogs[tenantsKey(queue)]) != 0 {
+			t.Errorf("Expected tenant without pending messages to leave ready tenants, got %v", n)
+		}
+	})
+}
+
+func TestMemoryDriver_Claim(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:test-queue"
+
+	t.Run("it_should_claim_key_once_within_window", func(t *testing.T) {
+		for _, expect := range []bool{true, false} {
+			if got, err := d.Claim(context.Background(), queue, "test-key", time.Hour); err != nil || got != expect {
+				t.Errorf("Expected Claim() to return %v, got %v, %v", expect, got, err)
+			}
+		}
+	})
+
+	t.Run("it_should_claim_released_key_again", func(t *testing.T) {
+		_ = d.Release(context.Background(), queue, "test-key")
+
+		if got, _ := d.Claim(context.Background(), queue, "test-key", time.Hour); !got {
+			t.Errorf("Expected Claim() to claim released key")
+		}
+	})
+
+	t.Run("it_should_claim_key_again_once_window_passes", func(t *testing.T) {
+		_, _ = d.Claim(context.Background(), queue, "short-key", time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+
+		if got, _ := d.Claim(context.Background(), queue, "short-key", time.Millisecond); !got {
+			t.Errorf("Expected Claim() to claim expired key")
+		}
+	})
+
+	t.Run("it_should_delete_expired_claims", func(t *testing.T) {
+		_, _ = d.Claim(context.Background(), queue, "unique-key", time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		// as if claimSweepInterval passed
+		d.claimsSwept = time.Time{}
+
+		_, _ = d.Claim(context.Background(), queue, "other-key", time.Hour)
+
+		if _, ok := d.claims[queue+":idempotency:unique-key"]; ok {
+			t.Errorf("Expected expired claim to be deleted, got %v claims", len(d.claims))
+		}
+	})
+}
+
+func TestMemoryDriver_Lock(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:test-queue"
+
+	t.Run("it_should_lock_key_for_a_single_owner", func(t *testing.T) {
+		for _, owner := range []string{"a", "b", "a"} {
+			expect := owner == "a"
+
+			if got, err := d.Lock(context.Background(), queue, "test-key", owner, time.Hour); err != nil || got != expect {
+				t.Errorf("Expected Lock() by %s to return %v, got %v, %v", owner, expect, got, err)
+			}
+		}
+	})
+
+	t.Run("it_should_only_unlock_for_owner", func(t *testing.T) {
+		_ = d.Unlock(context.Background(), queue, "test-key", "b")
+
+		if got, _ := d.Lock(context.Background(), queue, "test-key", "b", time.Hour); got {
+			t.Errorf("Expected Unlock() by another owner to keep the lock")
+		}
+
+		_ = d.Unlock(context.Background(), queue, "test-key", "a")
+
+		if got, _ := d.Lock(context.Background(), queue, "test-key", "b", time.Hour); !got {
+			t.Errorf("Expected Lock() to lock released key")
+		}
+	})
+}
+
+func TestMemoryDriver_Take(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:test-queue"
+
+	t.Run("it_should_take_burst_tokens_then_wait", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if wait, err := d.Take(context.Background(), queue, 10, 2); err != nil || wait != 0 {
+				t.Errorf("Expected Take() to take a token, got %v, %v", wait, err)
+			}
+		}
+
+		if wait, err := d.Take(context.Background(), queue, 10, 2); err != nil || wait <= 0 || wait > 100*time.Millisecond {
+			t.Errorf("Expected Take() to wait up to 100ms, got %v, %v", wait, err)
+		}
+	})
+
+	t.Run("it_should_refill_tokens_over_time", func(t *testing.T) {
+		time.Sleep(150 * time.Millisecond)
+
+		if wait, err := d.Take(context.Background(), queue, 10, 2); err != nil || wait != 0 {
+			t.Errorf("Expected Take() to take a refilled token, got %v, %v", wait, err)
+		}
+	})
+}
+
+func TestMemoryDriver_AcquireSlot(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:test-queue"
+
+	t.Run("it_should_hand_out_up_to_limit_slots", func(t *testing.T) {
+		for _, holder := range []string{"a", "b", "c", "a"} {
+			expect := holder != "c"
+
+			if got, err := d.AcquireSlot(context.Background(), queue, holder, 2, time.Hour); err != nil || got != expect {
+				t.Errorf("Expected AcquireSlot() by %s to return %v, got %v, %v", holder, expect, got, err)
+			}
+		}
+	})
+
+	t.Run("it_should_hand_out_released_slot", func(t *testing.T) {
+		_ = d.ReleaseSlot(context.Background(), queue, "a")
+
+		if got, _ := d.AcquireSlot(context.Background(), queue, "c", 2, time.Hour); !got {
+			t.Errorf("Expected AcquireSlot() to take released slot")
+		}
+	})
+
+	t.Run("it_should_hand_out_slot_once_lease_expires", func(t *testing.T) {
+		_ = d.ReleaseSlot(context.Background(), queue, "b")
+		_, _ = d.AcquireSlot(context.Background(), queue, "b", 2, time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+
+		if got, _ := d.AcquireSlot(context.Background(), queue, "d", 2, time.Hour); !got {
+			t.Errorf("Expected AcquireSlot() to take expired slot")
+		}
+	})
+}
+
+func TestMemoryDriver_groups(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+	ctx := context.Background()
+
+	for _, m := range []string{"a1", "a2"} {
+		_ = d.WriteGroup(ctx, queue, "a", []byte(m))
+	}
+
+	_ = d.WriteGroup(ctx, queue, "b", []byte("b1"))
+
+	t.Run("it_should_read_groups_round_robin_first_in_first_out", func(t *testing.T) {
+		for _, expect := range []string{"a:a1", "b:b1"} {
+			if g, m, err := d.ReadGroup(ctx, queue, time.Hour); err != nil || g+":"+string(m) != expect {
+				t.Errorf("Expected ReadGroup() to return %s, got %s:%s, %v", expect, g, m, err)
+			}
+		}
+	})
+
+	t.Run("it_should_not_read_locked_groups", func(t *testing.T) {
+		if g, m, err := d.ReadGroup(ctx, queue, time.Hour); err != redis.Nil {
+			t.Errorf("Expected ReadGroup() to return redis.Nil, got %s:%s, %v", g, m, err)
+		}
+	})
+
+	t.Run("it_should_unlock_acknowledged_group", func(t *testing.T) {
+		_ = d.AckGroup(ctx, queue, "a", []byte("a1"))
+
+		if g, m, err := d.ReadGroup(ctx, queue, time.Hour); err != nil || g != "a" || string(m) != "a2" {
+			t.Errorf("Expected ReadGroup() to return a:a2, got %s:%s, %v", g, m, err)
+		}
+	})
+
+	t.Run("it_should_read_nacked_message_first_once_its_delay_passes", func(t *testing.T) {
+		_ = d.WriteGroup(ctx, queue, "a", []byte("a3"))
+		_ = d.NackGroup(ctx, queue, "a", []byte("a2"), []byte("a2-retry"), time.Now().Add(5*time.Millisecond))
+
+		if _, _, err := d.ReadGroup(ctx, queue, time.Hour); err != redis.Nil {
+			t.Errorf("Expected ReadGroup() to keep group locked, got %v", err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		if g, m, err := d.ReadGroup(ctx, queue, time.Millisecond); err != nil || g != "a" || string(m) != "a2-retry" {
+			t.Errorf("Expected ReadGroup() to return a:a2-retry, got %s:%s, %v", g, m, err)
+		}
+	})
+
+	t.Run("it_should_read_message_again_once_its_lease_expires", func(t *testing.T) {
+		time.Sleep(5 * time.Millisecond)
+
+		if g, m, err := d.ReadGroup(ctx, queue, time.Hour); err != nil || g != "a" || string(m) != "a2-retry" {
+			t.Errorf("Expected ReadGroup() to return a:a2-retry, got %s:%s, %v", g, m, err)
+		}
+	})
+
+	t.Run("it_should_renew_lease_of_in_flight_message_only", func(t *testing.T) {
+		if renewed, err := d.RenewGroup(ctx, queue, "a", []byte("a3"), time.Hour); err != nil || renewed {
+			t.Errorf("Expected RenewGroup() not to renew lease for a message which is not in flight, got %v, %v", renewed, err)
+		}
+
+		if renewed, err := d.RenewGroup(ctx, queue, "a", []byte("a2-retry"), 5*time.Millisecond); err != nil || !renewed {
+			t.Errorf("Expected RenewGroup() to renew lease, got %v, %v", renewed, err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		if g, m, err := d.ReadGroup(ctx, queue, time.Hour); err != nil || g != "a" || string(m) != "a2-retry" {
+			t.Errorf("Expected ReadGroup() to return a:a2-retry once renewed lease expired, got %s:%s, %v", g, m, err)
+		}
+	})
+}
+
+func TestMemoryDriver_tenants(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:active:test-queue"
+	ctx := context.Background()
+	_ = d.Register(ctx, "test-queue")
+
+	for _, m := range []string{"a1", "a2", "a3", "a4"} {
+		_ = d.WriteTenant(ctx, queue, "a", []byte(m))
+	}
+
+	for _, m := range []string{"b1", "b2"} {
+		_ = d.WriteTenant(ctx, queue, "b", []byte(m))
+	}
+
+	_ = d.WriteTenant(ctx, queue+":priority:5", "a", []byte("a5"))
+
+	t.Run("it_should_count_backlogs_of_tenants", func(t *testing.T) {
+		expect := map[string]int64{"a": 5, "b": 2}
+
+		if got, err := d.GetStats(ctx); err != nil || !reflect.DeepEqual((*got)["test-queue"].TenantBacklogs, expect) {
+			t.Errorf("Expected GetStats() to return backlogs %v, got %v, %v", expect, got, err)
+		}
+	})
+
+	t.Run("it_should_read_tenants_round_robin_by_weight", func(t *testing.T) {
+		for _, expect := range []string{"a:a1", "a:a2", "b:b1", "a:a3", "a:a4", "b:b2"} {
+			if tenant, m, err := d.ReadTenant(ctx, queue, map[string]int{"a": 2}); err != nil || tenant+":"+string(m) != expect {
+				t.Errorf("Expected ReadTenant() to return %s, got %s:%s, %v", expect, tenant, m, err)
+			}
+		}
+
+		if tenant, m, err := d.ReadTenant(ctx, queue, nil); err != redis.Nil {
+			t.Errorf("Expected ReadTenant() to return redis.Nil, got %s:%s, %v", tenant, m, err)
+		}
+	})
+
+	t.Run("it_should_read_nacked_message_again", func(t *testing.T) {
+		_ = d.NackTenant(ctx, queue, "a", []byte("a4"))
+
+		if tenant, m, err := d.ReadTenant(ctx, queue, nil); err != nil || tenant != "a" || string(m) != "a4" {
+			t.Errorf("Expected ReadTenant() to return a:a4, got %s:%s, %v", tenant, m, err)
+		}
+
+		_ = d.Ack(ctx, queue, []byte("a4"))
+	})
+
+	t.Run("it_should_count_backlogs_of_every_priority_level", func(t *testing.T) {
+		expect := map[string]int64{"a": 1}
+
+		if got, err := d.GetStats(ctx); err != nil || !reflect.DeepEqual((*got)["test-queue"].TenantBacklogs, expect) {
+			t.Errorf("Expected GetStats() to return backlogs %v, got %v, %v", expect, got, err)
+		}
+	})
+
+	t.Run("it_should_promote_scheduled_message_back_to_its_tenant", func(t *testing.T) {
+		m := []byte(`{"id":"scheduled","tenant_key":"b"}`)
+		_ = d.Schedule(ctx, queue, m, time.Now())
+
+		if n, err := d.Promote(ctx, queue, time.Now()); err != nil || n != 1 {
+			t.Errorf("Expected Promote() to promote 1 message, got %v, %v", n, err)
+		}
+
+		if tenant, got, err := d.ReadTenant(ctx, queue, nil); err != nil || tenant != "b" || string(got) != string(m) {
+			t.Errorf("Expected ReadTenant() to return promoted message of tenant b, got %s:%s, %v", tenant, got, err)
+		}
+	})
+}
+
+func TestMemoryDriver_DeadLetters(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := "simple-queue:data:test-queue"
+
+	t.Run("it_should_keep_dead_letters", func(t *testing.T) {
+		_ = d.AddDeadLetter(context.Background(), queue, "test-id", []byte("test-data"))
+
+		if got, err := d.GetDeadLetters(context.Background(), queue); err != nil || !reflect.DeepEqual(got, [][]byte{[]byte("test-data")}) {
+			t.Errorf("Expected GetDeadLetters() to return test-data, got %s, %v", got, err)
+		}
+
+		if got, err := d.GetDeadLetter(context.Background(), queue, "test-id"); err != nil || string(got) != "test-data" {
+			t.Errorf("Expected GetDeadLetter() to return test-data, got %s, %v", got, err)
+		}
+	})
+
+	t.Run("it_should_delete_dead_letter", func(t *testing.T) {
+		_ = d.DeleteDeadLetter(context.Background(), queue, "test-id")
+
+		if _, err := d.GetDeadLetter(context.Background(), queue, "test-id"); err != ErrMessageNotFound {
+			t.Errorf("Expected GetDeadLetter() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+	})
+}
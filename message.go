@@ -1,8 +1,10 @@
 package simpleq
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/google/uuid"
+	"time"
 )
 
 // Task is a task interface to be implemented a users
@@ -12,6 +14,32 @@ type Task interface {
 	Fail(err error)
 }
 
+// ContextTask is a Task receiving the context of its execution,
+// the context is cancelled once the queue is stopped.
+// Once implemented it should be passed into executor as queue.OnExecContext(new(impl))
+type ContextTask interface {
+	RunContext(ctx context.Context, c Context) error
+	Fail(err error)
+}
+
+// BatchTask is a task handling many messages at once, RunBatch returns an error per message
+// (or nil when every message was handled) so only failed messages are retried or failed.
+// Once implemented it should be passed into executor as queue.OnExecBatch(new(impl), size, wait)
+type BatchTask interface {
+	RunBatch(ctx context.Context, cs []Context) []error
+	Fail(err error)
+}
+
+// contextTask adapts a Task to ContextTask, the context is dropped
+type contextTask struct {
+	Task
+}
+
+// RunContext runs the adapted task
+func (t contextTask) RunContext(_ context.Context, c Context) error {
+	return t.Run(c)
+}
+
 // Context is a task interface
 type Context interface {
 	SetID()
@@ -39,12 +67,25 @@ func NewMessage(c Content) *Message {
 	return &Message{Content: c}
 }
 
+// NewMessageWithID returns a pointer to a new message instance with a caller supplied ID (e.g. an order number)
+func NewMessageWithID(id string, c Content) *Message {
+	return &Message{ID: id, Content: c}
+}
+
 // Message is a single message instance
 type Message struct {
-	Attempts    int     `json:"attempts"`
-	MaxAttempts int     `json:"max_attempts"`
-	ID          string  `json:"id"`
-	Content     Content `json:"content"`
+	Attempts       int           `json:"attempts"`
+	MaxAttempts    int           `json:"max_attempts"`
+	ID             string        `json:"id"`
+	Content        Content       `json:"content"`
+	History        []Attempt     `json:"history,omitempty"`
+	Timeout        time.Duration `json:"timeout,omitempty"`
+	Priority       int           `json:"priority,omitempty"`
+	ExpiresAt      *time.Time    `json:"expires_at,omitempty"`
+	IdempotencyKey string        `json:"idempotency_key,omitempty"`
+	UniqueKey      string        `json:"unique_key,omitempty"`
+	GroupKey       string        `json:"group_key,omitempty"`
+	TenantKey      string        `json:"tenant_key,omitempty"`
 }
 
 // GetContent returns message content
@@ -72,6 +113,11 @@ func (m *Message) SetID() {
 	m.ID = uuid.New().String()
 }
 
+// AssignID sets the message's ID, queues assign IDs of their generator (see WithIDGenerator) with it
+func (m *Message) AssignID(id string) {
+	m.ID = id
+}
+
 // SetContent sets data to task
 func (m *Message) SetContent(c Content) {
 	m.Content = c
@@ -82,6 +128,89 @@ func (m *Message) SetMaxAttempts(a int) {
 	m.MaxAttempts = a
 }
 
+// GetTimeout returns how long the message may run, 0 falls back to the queue's task timeout
+func (m *Message) GetTimeout() time.Duration {
+	return m.Timeout
+}
+
+// SetTimeout sets how long the message may run, overriding the queue's task timeout
+func (m *Message) SetTimeout(d time.Duration) {
+	m.Timeout = d
+}
+
+// GetPriority returns the message's priority, higher priorities are read first
+func (m *Message) GetPriority() int {
+	return m.Priority
+}
+
+// SetPriority sets the message's priority, the queue must read it (see WithPriorities)
+func (m *Message) SetPriority(p int) {
+	m.Priority = p
+}
+
+// GetExpiresAt returns when the message expires, zero when it never does
+func (m *Message) GetExpiresAt() time.Time {
+	if m.ExpiresAt == nil {
+		return time.Time{}
+	}
+
+	return *m.ExpiresAt
+}
+
+// SetExpiresAt sets when the message expires, it is skipped instead of run once read after at
+func (m *Message) SetExpiresAt(at time.Time) {
+	m.ExpiresAt = &at
+}
+
+// Expired tells whether the message has expired by now
+func (m *Message) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !now.Before(*m.ExpiresAt)
+}
+
+// GetIdempotencyKey returns the key deduplicating pushes of the message
+func (m *Message) GetIdempotencyKey() string {
+	return m.IdempotencyKey
+}
+
+// SetIdempotencyKey sets the key deduplicating pushes of the message,
+// pushes of messages with a key pushed within the queue's dedup window are rejected
+func (m *Message) SetIdempotencyKey(key string) {
+	m.IdempotencyKey = key
+}
+
+// GetUniqueKey returns the key of the unique job the message is
+func (m *Message) GetUniqueKey() string {
+	return m.UniqueKey
+}
+
+// SetUniqueKey makes the message a unique job, no other message with the same key
+// can be pushed while it is pending or running
+func (m *Message) SetUniqueKey(key string) {
+	m.UniqueKey = key
+}
+
+// GetGroupKey returns the key of the ordered group the message belongs to
+func (m *Message) GetGroupKey() string {
+	return m.GroupKey
+}
+
+// SetGroupKey puts the message into an ordered group, messages of a group are run
+// one at a time in the order they were pushed (see WithGroups)
+func (m *Message) SetGroupKey(key string) {
+	m.GroupKey = key
+}
+
+// GetTenantKey returns the key of the tenant the message belongs to
+func (m *Message) GetTenantKey() string {
+	return m.TenantKey
+}
+
+// SetTenantKey assigns the message to a tenant, queues with fair dispatch take turns
+// between tenants so a single one can not starve the others (see WithFairDispatch)
+func (m *Message) SetTenantKey(key string) {
+	m.TenantKey = key
+}
+
 // NewAttempt increments the attempt number
 func (m *Message) NewAttempt() {
 	m.Attempts++
@@ -96,3 +225,89 @@ func (m *Message) Marshal() ([]byte, error) {
 func (m *Message) Bind(v interface{}) error {
 	return m.Content.BindJSON(v)
 }
+
+// messageID returns the ID of a marshalled message, empty when it cannot be unmarshalled
+func messageID(d []byte) string {
+	var m Message
+
+	if err := json.Unmarshal(d, &m); err != nil {
+		return ""
+	}
+
+	return m.ID
+}
+
+// assignable is implemented by messages whose ID can be assigned
+type assignable interface {
+	AssignID(id string)
+}
+
+// prioritized is implemented by messages carrying a priority
+type prioritized interface {
+	GetPriority() int
+}
+
+// priorityOf returns the priority of c, 0 when it does not carry one
+func priorityOf(c Context) int {
+	if p, ok := c.(prioritized); ok {
+		return p.GetPriority()
+	}
+
+	return 0
+}
+
+// idempotent is implemented by messages carrying an idempotency key
+type idempotent interface {
+	GetIdempotencyKey() string
+}
+
+// idempotencyKeyOf returns the idempotency key of c, empty when it does not carry one
+func idempotencyKeyOf(c Context) string {
+	if i, ok := c.(idempotent); ok {
+		return i.GetIdempotencyKey()
+	}
+
+	return ""
+}
+
+// unique is implemented by messages which may be unique jobs
+type unique interface {
+	GetUniqueKey() string
+}
+
+// uniqueKeyOf returns the unique key of c, empty when it is not a unique job
+func uniqueKeyOf(c Context) string {
+	if u, ok := c.(unique); ok {
+		return u.GetUniqueKey()
+	}
+
+	return ""
+}
+
+// grouped is implemented by messages which may belong to an ordered group
+type grouped interface {
+	GetGroupKey() string
+}
+
+// groupKeyOf returns the group key of c, empty when it does not belong to a group
+func groupKeyOf(c Context) string {
+	if g, ok := c.(grouped); ok {
+		return g.GetGroupKey()
+	}
+
+	return ""
+}
+
+// tenanted is implemented by messages which may belong to a tenant
+type tenanted interface {
+	GetTenantKey() string
+}
+
+// tenantKeyOf returns the tenant key of c, empty when it does not belong to a tenant
+func tenantKeyOf(c Context) string {
+	if t, ok := c.(tenanted); ok {
+		return t.GetTenantKey()
+	}
+
+	return ""
+}
@@ -5,6 +5,7 @@
 package simpleq
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -59,6 +60,104 @@ func (mr *MockTaskMockRecorder) Run(c interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Run", reflect.TypeOf((*MockTask)(nil).Run), c)
 }
 
+// MockContextTask is a mock of ContextTask interface.
+type MockContextTask struct {
+	ctrl     *gomock.Controller
+	recorder *MockContextTaskMockRecorder
+}
+
+// MockContextTaskMockRecorder is the mock recorder for MockContextTask.
+type MockContextTaskMockRecorder struct {
+	mock *MockContextTask
+}
+
+// NewMockContextTask creates a new mock instance.
+func NewMockContextTask(ctrl *gomock.Controller) *MockContextTask {
+	mock := &MockContextTask{ctrl: ctrl}
+	mock.recorder = &MockContextTaskMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockContextTask) EXPECT() *MockContextTaskMockRecorder {
+	return m.recorder
+}
+
+// Fail mocks base method.
+func (m *MockContextTask) Fail(err error) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Fail", err)
+}
+
+// Fail indicates an expected call of Fail.
+func (mr *MockContextTaskMockRecorder) Fail(err interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fail", reflect.TypeOf((*MockContextTask)(nil).Fail), err)
+}
+
+// RunContext mocks base method.
+func (m *MockContextTask) RunContext(ctx context.Context, c Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunContext", ctx, c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RunContext indicates an expected call of RunContext.
+func (mr *MockContextTaskMockRecorder) RunContext(ctx, c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunContext", reflect.TypeOf((*MockContextTask)(nil).RunContext), ctx, c)
+}
+
+// MockBatchTask is a mock of BatchTask interface.
+type MockBatchTask struct {
+	ctrl     *gomock.Controller
+	recorder *MockBatchTaskMockRecorder
+}
+
+// MockBatchTaskMockRecorder is the mock recorder for MockBatchTask.
+type MockBatchTaskMockRecorder struct {
+	mock *MockBatchTask
+}
+
+// NewMockBatchTask creates a new mock instance.
+func NewMockBatchTask(ctrl *gomock.Controller) *MockBatchTask {
+	mock := &MockBatchTask{ctrl: ctrl}
+	mock.recorder = &MockBatchTaskMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBatchTask) EXPECT() *MockBatchTaskMockRecorder {
+	return m.recorder
+}
+
+// Fail mocks base method.
+func (m *MockBatchTask) Fail(err error) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Fail", err)
+}
+
+// Fail indicates an expected call of Fail.
+func (mr *MockBatchTaskMockRecorder) Fail(err interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fail", reflect.TypeOf((*MockBatchTask)(nil).Fail), err)
+}
+
+// RunBatch mocks base method.
+func (m *MockBatchTask) RunBatch(ctx context.Context, cs []Context) []error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunBatch", ctx, cs)
+	ret0, _ := ret[0].([]error)
+	return ret0
+}
+
+// RunBatch indicates an expected call of RunBatch.
+func (mr *MockBatchTaskMockRecorder) RunBatch(ctx, cs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunBatch", reflect.TypeOf((*MockBatchTask)(nil).RunBatch), ctx, cs)
+}
+
 // MockContext is a mock of Context interface.
 type MockContext struct {
 	ctrl     *gomock.Controller
@@ -214,3 +313,188 @@ func (mr *MockContextMockRecorder) SetMaxAttempts(a interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxAttempts", reflect.TypeOf((*MockContext)(nil).SetMaxAttempts), a)
 }
+
+// Mockprioritized is a mock of prioritized interface.
+type Mockprioritized struct {
+	ctrl     *gomock.Controller
+	recorder *MockprioritizedMockRecorder
+}
+
+// MockprioritizedMockRecorder is the mock recorder for Mockprioritized.
+type MockprioritizedMockRecorder struct {
+	mock *Mockprioritized
+}
+
+// NewMockprioritized creates a new mock instance.
+func NewMockprioritized(ctrl *gomock.Controller) *Mockprioritized {
+	mock := &Mockprioritized{ctrl: ctrl}
+	mock.recorder = &MockprioritizedMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockprioritized) EXPECT() *MockprioritizedMockRecorder {
+	return m.recorder
+}
+
+// GetPriority mocks base method.
+func (m *Mockprioritized) GetPriority() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPriority")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GetPriority indicates an expected call of GetPriority.
+func (mr *MockprioritizedMockRecorder) GetPriority() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPriority", reflect.TypeOf((*Mockprioritized)(nil).GetPriority))
+}
+
+// Mockidempotent is a mock of idempotent interface.
+type Mockidempotent struct {
+	ctrl     *gomock.Controller
+	recorder *MockidempotentMockRecorder
+}
+
+// MockidempotentMockRecorder is the mock recorder for Mockidempotent.
+type MockidempotentMockRecorder struct {
+	mock *Mockidempotent
+}
+
+// NewMockidempotent creates a new mock instance.
+func NewMockidempotent(ctrl *gomock.Controller) *Mockidempotent {
+	mock := &Mockidempotent{ctrl: ctrl}
+	mock.recorder = &MockidempotentMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockidempotent) EXPECT() *MockidempotentMockRecorder {
+	return m.recorder
+}
+
+// GetIdempotencyKey mocks base method.
+func (m *Mockidempotent) GetIdempotencyKey() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIdempotencyKey")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetIdempotencyKey indicates an expected call of GetIdempotencyKey.
+func (mr *MockidempotentMockRecorder) GetIdempotencyKey() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIdempotencyKey", reflect.TypeOf((*Mockidempotent)(nil).GetIdempotencyKey))
+}
+
+// Mockunique is a mock of unique interface.
+type Mockunique struct {
+	ctrl     *gomock.Controller
+	recorder *MockuniqueMockRecorder
+}
+
+// MockuniqueMockRecorder is the mock recorder for Mockunique.
+type MockuniqueMockRecorder struct {
+	mock *Mockunique
+}
+
+// NewMockunique creates a new mock instance.
+func NewMockunique(ctrl *gomock.Controller) *Mockunique {
+	mock := &Mockunique{ctrl: ctrl}
+	mock.recorder = &MockuniqueMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockunique) EXPECT() *MockuniqueMockRecorder {
+	return m.recorder
+}
+
+// GetUniqueKey mocks base method.
+func (m *Mockunique) GetUniqueKey() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUniqueKey")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetUniqueKey indicates an expected call of GetUniqueKey.
+func (mr *MockuniqueMockRecorder) GetUniqueKey() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUniqueKey", reflect.TypeOf((*Mockunique)(nil).GetUniqueKey))
+}
+
+// Mockgrouped is a mock of grouped interface.
+type Mockgrouped struct {
+	ctrl     *gomock.Controller
+	recorder *MockgroupedMockRecorder
+}
+
+// MockgroupedMockRecorder is the mock recorder for Mockgrouped.
+type MockgroupedMockRecorder struct {
+	mock *Mockgrouped
+}
+
+// NewMockgrouped creates a new mock instance.
+func NewMockgrouped(ctrl *gomock.Controller) *Mockgrouped {
+	mock := &Mockgrouped{ctrl: ctrl}
+	mock.recorder = &MockgroupedMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mockgrouped) EXPECT() *MockgroupedMockRecorder {
+	return m.recorder
+}
+
+// GetGroupKey mocks base method.
+func (m *Mockgrouped) GetGroupKey() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroupKey")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetGroupKey indicates an expected call of GetGroupKey.
+func (mr *MockgroupedMockRecorder) GetGroupKey() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroupKey", reflect.TypeOf((*Mockgrouped)(nil).GetGroupKey))
+}
+
+// Mocktenanted is a mock of tenanted interface.
+type Mocktenanted struct {
+	ctrl     *gomock.Controller
+	recorder *MocktenantedMockRecorder
+}
+
+// MocktenantedMockRecorder is the mock recorder for Mocktenanted.
+type MocktenantedMockRecorder struct {
+	mock *Mocktenanted
+}
+
+// NewMocktenanted creates a new mock instance.
+func NewMocktenanted(ctrl *gomock.Controller) *Mocktenanted {
+	mock := &Mocktenanted{ctrl: ctrl}
+	mock.recorder = &MocktenantedMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *Mocktenanted) EXPECT() *MocktenantedMockRecorder {
+	return m.recorder
+}
+
+// GetTenantKey mocks base method.
+func (m *Mocktenanted) GetTenantKey() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTenantKey")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetTenantKey indicates an expected call of GetTenantKey.
+func (mr *MocktenantedMockRecorder) GetTenantKey() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTenantKey", reflect.TypeOf((*Mocktenanted)(nil).GetTenantKey))
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/google/uuid"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestContent_BindJSON(t *testing.T) {
@@ -159,3 +160,80 @@ func TestMessage_SetMaxAttempts(t *testing.T) {
 		}
 	})
 }
+
+func TestNewMessageWithID(t *testing.T) {
+	t.Run("it_should_return_new_message_with_id", func(t *testing.T) {
+		expect := Message{ID: "order-1", Content: Content("{}")}
+
+		if got := NewMessageWithID("order-1", Content("{}")); !reflect.DeepEqual(got, &expect) {
+			t.Errorf("Expected NewMessageWithID() to return %v, got %v", expect, got)
+		}
+	})
+}
+
+func TestMessage_AssignID(t *testing.T) {
+	t.Run("it_should_set_assigned_id", func(t *testing.T) {
+		m := Message{}
+		m.AssignID("generated-id")
+
+		if m.ID != "generated-id" {
+			t.Errorf("Expected AssignID() to set generated-id, got %v", m.ID)
+		}
+	})
+}
+
+func TestMessage_SetTimeout(t *testing.T) {
+	t.Run("it_should_keep_timeout_through_marshal", func(t *testing.T) {
+		m := NewMessage(Content("{}"))
+		m.SetTimeout(time.Minute)
+
+		d, _ := m.Marshal()
+
+		var got Message
+		_ = json.Unmarshal(d, &got)
+
+		if got.GetTimeout() != time.Minute {
+			t.Errorf("Expected GetTimeout() to return %v, got %v", time.Minute, got.GetTimeout())
+		}
+	})
+}
+
+func TestMessage_SetPriority(t *testing.T) {
+	t.Run("it_should_keep_priority_through_marshal", func(t *testing.T) {
+		m := NewMessage(Content("{}"))
+		m.SetPriority(5)
+
+		d, _ := m.Marshal()
+
+		var got Message
+		_ = json.Unmarshal(d, &got)
+
+		if got.GetPriority() != 5 {
+			t.Errorf("Expected GetPriority() to return 5, got %v", got.GetPriority())
+		}
+	})
+}
+
+func TestMessage_Expired(t *testing.T) {
+	now := time.Now()
+
+	t.Run("it_should_never_expire_without_expiry", func(t *testing.T) {
+		if NewMessage(Content("{}")).Expired(now) {
+			t.Errorf("Expected Expired() to return false")
+		}
+	})
+
+	t.Run("it_should_expire_once_expiry_passes", func(t *testing.T) {
+		m := NewMessage(Content("{}"))
+		m.SetExpiresAt(now)
+
+		d, _ := m.Marshal()
+
+		var got Message
+		_ = json.Unmarshal(d, &got)
+
+		if got.Expired(now.Add(-time.Second)) || !got.Expired(now) {
+			t.Errorf("Expected Expired() to return true from %v on", now)
+		}
+	})
+}
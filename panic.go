@@ -0,0 +1,28 @@
+package simpleq
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error a run is failed with when its task panics
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error returns the panic value followed by the stack of the panicking goroutine
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v\n%s", pe.Value, pe.Stack)
+}
+
+// recovered calls fn turning a panic into a PanicError
+func recovered(fn func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+
+	return fn()
+}
@@ -0,0 +1,55 @@
+package simpleq
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type panickingTask struct {
+	failed chan error
+}
+
+func (pt *panickingTask) Run(c Context) error {
+	panic("boom")
+}
+
+func (pt *panickingTask) Fail(err error) {
+	pt.failed <- err
+}
+
+// panickingFailTask fails every run and panics once it is failed
+type panickingFailTask struct{}
+
+func (pf *panickingFailTask) Run(c Context) error {
+	return errors.New("failed to run")
+}
+
+func (pf *panickingFailTask) Fail(err error) {
+	panic("boom")
+}
+
+func TestRecovered(t *testing.T) {
+	t.Run("it_should_turn_panic_into_error_with_stack", func(t *testing.T) {
+		err := recovered(func() error {
+			return new(panickingTask).Run(NewMessage(nil))
+		})
+
+		var pe *PanicError
+
+		if !errors.As(err, &pe) || pe.Value != "boom" {
+			t.Fatalf("Expected recovered() to return PanicError, got %v", err)
+		}
+
+		if !strings.Contains(pe.Error(), "panickingTask") {
+			t.Errorf("Expected PanicError to carry the stack trace, got %v", pe.Error())
+		}
+	})
+
+	t.Run("it_should_return_task_error", func(t *testing.T) {
+		if err := recovered(func() error { return fmt.Errorf("failed to run") }); err == nil {
+			t.Errorf("Expected recovered() to return error")
+		}
+	})
+}
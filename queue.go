@@ -1,149 +1,2071 @@
 package simpleq
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	queuePrefix = "simple-queue:data"
+	queuePrefix     = "simple-queue:data"
+	promoteInterval = 100 * time.Millisecond
+	// blockTimeout bounds a single blocking read, Stop() may wait for it to return
+	blockTimeout = time.Second
+	// heartbeatTTL is how long a consumer is kept alive by a heartbeat, messages left in flight by
+	// consumers without a heartbeat for as long are returned to the queue
+	heartbeatTTL = 30 * time.Second
+	// default pauses between reads of an empty queue when the driver can not block
+	defaultMinPoll = 10 * time.Millisecond
+	defaultMaxPoll = time.Second
+	// defaultDedupWindow is how long idempotency keys are remembered by default
+	defaultDedupWindow = 24 * time.Hour
+	// defaultUniqueTTL is how long locks of unique jobs are held by default
+	defaultUniqueTTL = time.Hour
+	// defaultSlotLease is how long a slot of a concurrency limit is leased by default
+	defaultSlotLease = 30 * time.Second
+	// defaultGroupLease is how long a message group is locked at most by default
+	defaultGroupLease = 5 * time.Minute
 )
 
-var (
-	driver Driver
-	logger Logger
-)
+var defaultBackoff = ExponentialBackoff(time.Second, 10*time.Minute)
+
+// ErrTaskTimeout is the error a run is failed with once it exceeds its timeout
+var ErrTaskTimeout = errors.New("task timed out")
+
+// ErrMessageExpired is the error expired messages are dead lettered with, see WithExpiredDeadLetters
+var ErrMessageExpired = errors.New("message expired")
+
+// ErrDuplicateMessage is returned when a message is pushed with an idempotency key
+// which has been pushed within the queue's dedup window already
+var ErrDuplicateMessage = errors.New("duplicate message")
+
+// ErrUniqueJobLocked is returned when a unique job is pushed while another message
+// with the same unique key is pending or running
+var ErrUniqueJobLocked = errors.New("unique job is already pending or running")
+
+// ErrGroupsDisabled is returned when a message with a group key is pushed to a queue not reading groups
+var ErrGroupsDisabled = errors.New("message groups are not read by the queue")
+
+// ErrFairDispatchDisabled is returned when a message with a tenant key is pushed to a queue without fair dispatch
+var ErrFairDispatchDisabled = errors.New("fair dispatch is not enabled for the queue")
+
+// ErrUnknownPriority is returned when a message is pushed with a priority the queue does not read
+var ErrUnknownPriority = errors.New("priority is not read by the queue")
 
-// Init initializes simple queue with a given driver implementation
+// Init initializes simple queue with a given driver implementation,
+// queues created with NewQueue() and Queue instances without a client use it
 func Init(d Driver, l Logger) {
-	driver = d
-	logger = l
+	defaultClient = NewClient(d, l)
 }
 
 // Queueable is a queue interface
 type Queueable interface {
 	Push(t Context) error
+	PushContext(ctx context.Context, t Context) error
+	PushBatch(ts []Context) []PushResult
+	PushBatchContext(ctx context.Context, ts []Context) []PushResult
+	PushAt(t Context, at time.Time) error
+	PushAtContext(ctx context.Context, t Context, at time.Time) error
+	PushIn(t Context, d time.Duration) error
+	Reschedule(id string, at time.Time) error
+	Delete(id string) error
+	DeadLetters() ([]*DeadLetter, error)
+	DeadLetter(id string) (*DeadLetter, error)
+	ReplayDeadLetter(id string) error
+	DeleteDeadLetter(id string) error
 	OnExec(task Task)
+	OnExecContext(task ContextTask)
+	OnExecBatch(task BatchTask, size int, wait time.Duration)
 	Requeue(t Context) error
-	Stop()
+	Stop(ctx context.Context) error
 }
 
-// NewQueue returns a pointer to a new Queue instance
-func NewQueue(name string, workers int8) (*Queue, error) {
-	if err := driver.Register(name); err != nil {
-		logger.Warn(fmt.Sprintf("Failed to register, %v", err))
+// PushResult is the outcome of pushing a single message of a batch
+type PushResult struct {
+	ID  string
+	Err error
+}
+
+// QueueOption configures a Queue
+type QueueOption func(q *Queue)
+
+// WithBackoff sets how long failed messages wait before they are retried,
+// exponential backoff from a second up to 10 minutes is used by default
+func WithBackoff(b Backoff) QueueOption {
+	return func(q *Queue) {
+		q.backoff = b
 	}
+}
 
-	logger.Info(fmt.Sprintf("Initialized queue %s", name))
+// WithDriverTimeout bounds every driver call made by the queue,
+// calls are only bound by the context they are given by default
+func WithDriverTimeout(d time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.driverTimeout = d
+	}
+}
 
-	return &Queue{
-		Workers:  workers,
-		Name:     name,
-		StopC:    make(chan struct{}),
-		stopExec: make(chan struct{}),
-	}, nil
+// WithTaskTimeout sets how long a task may run before its context is cancelled and the run
+// is failed with ErrTaskTimeout, Message.SetTimeout() overrides it for a single message.
+// A task ignoring its context is abandoned and may still run alongside the retry of its message,
+// it keeps its concurrency slot until it returns
+func WithTaskTimeout(d time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.taskTimeout = d
+	}
+}
+
+// WithRepanic makes workers panic again once a panicking task's message is handed back to the queue,
+// panics are failed like any other error by default
+func WithRepanic() QueueOption {
+	return func(q *Queue) {
+		q.repanic = true
+	}
+}
+
+// WithPollInterval sets the pauses between reads of an empty queue when the driver does not
+// implement BlockingReader, the pause doubles from min up to max while the queue stays empty
+func WithPollInterval(min, max time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.minPoll = min
+		q.maxPoll = max
+	}
+}
+
+// WithPriorities sets the priority levels read by the queue on top of the default 0,
+// higher levels are read first. Each level is kept as a queue of its own, queues with
+// more than one level poll them (see WithPollInterval) as they can not block on all at once
+func WithPriorities(levels ...int) QueueOption {
+	return func(q *Queue) {
+		q.priorities = []int{0}
+
+		for _, l := range levels {
+			if !containsInt(q.priorities, l) {
+				q.priorities = append(q.priorities, l)
+			}
+		}
+
+		sort.Sort(sort.Reverse(sort.IntSlice(q.priorities)))
+	}
+}
+
+// WithStarvationLimit makes every read following n reads which preferred the highest priority
+// prefer a lower level instead, rotating through them, so a steady flow of high priority messages
+// can not starve lower ones. Higher priorities are always preferred by default
+func WithStarvationLimit(n int) QueueOption {
+	return func(q *Queue) {
+		q.starvationLimit = n
+	}
+}
+
+// WithExpiredHandler sets a callback invoked with every message skipped as it expired before it could run
+func WithExpiredHandler(fn func(c Context)) QueueOption {
+	return func(q *Queue) {
+		q.onExpired = fn
+	}
+}
+
+// WithExpiredDeadLetters moves messages skipped as they expired to the dead letters,
+// the driver must implement DeadLetterStore. Expired messages are only counted by default
+func WithExpiredDeadLetters() QueueOption {
+	return func(q *Queue) {
+		q.expiredDeadLetters = true
+	}
+}
+
+// WithDedupWindow sets how long idempotency keys of pushed messages are remembered,
+// pushes of a key within the window return ErrDuplicateMessage. It is 24 hours by default
+func WithDedupWindow(d time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.dedupWindow = d
+	}
+}
+
+// WithUniqueTTL sets how long locks of unique jobs are held at most, so a job whose consumer died
+// does not lock its key forever. Locks are refreshed on retries and held for an hour by default
+func WithUniqueTTL(d time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.uniqueTTL = d
+	}
+}
+
+// WithRateLimit limits task runs to perSecond across every process consuming the queue,
+// up to burst runs may start at once. Workers wait for a token before each run (a whole batch
+// for batch tasks), the driver must implement RateLimiter
+func WithRateLimit(perSecond float64, burst int) QueueOption {
+	return func(q *Queue) {
+		q.rateLimit = perSecond
+		q.rateBurst = burst
+	}
+}
+
+// WithConcurrencyLimit limits how many tasks run at once across every process consuming the queue,
+// workers wait for a slot before each run (a whole batch for batch tasks). Slots are leased for lease
+// (30 seconds when 0) and renewed while their task runs, so slots of a dead process are freed once
+// their lease expires. The driver must implement Semaphore
+func WithConcurrencyLimit(limit int, lease time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.concurrency = limit
+		q.slotLease = lease
+	}
+}
+
+// WithGroups makes the queue read ordered message groups (see Message.SetGroupKey), messages of a group
+// run one at a time in push order while different groups run in parallel. A group is locked while one of
+// its messages runs, the lock is leased for lease (5 minutes when 0) and renewed until the task returns so
+// groups of a dead process are picked up again. Retries stay at the head of their group. The driver must implement GroupStore
+func WithGroups(lease time.Duration) QueueOption {
+	return func(q *Queue) {
+		q.groups = true
+		q.groupLease = lease
+	}
+}
+
+// WithFairDispatch makes the queue keep messages of each tenant apart (see Message.SetTenantKey) and take turns
+// between tenants, reading up to their weight in messages (1 when missing from weights) before the next one,
+// so a tenant flooding the queue can not starve the others. Messages without a tenant get a turn of their own.
+// The driver must implement TenantStore
+func WithFairDispatch(weights map[string]int) QueueOption {
+	return func(q *Queue) {
+		q.fair = true
+		q.tenantWeights = map[string]int{}
+
+		for tenant, weight := range weights {
+			if weight < 1 {
+				weight = 1
+			}
+
+			q.tenantWeights[tenant] = weight
+		}
+	}
+}
+
+// WithIDGenerator sets how IDs of messages pushed without one are generated (e.g. time sortable ULIDs),
+// random UUIDs are generated by default. Messages other than Message generate their own ID with SetID()
+func WithIDGenerator(gen func() string) QueueOption {
+	return func(q *Queue) {
+		q.idGenerator = gen
+	}
+}
+
+// NewQueue returns a pointer to a new Queue instance using the driver and logger given to Init()
+func NewQueue(name string, workers int8, opts ...QueueOption) (*Queue, error) {
+	return defaultClient.NewQueue(name, workers, opts...)
 }
 
 // Queue is an instance queue handler
-// use DelayedQueue for delayed (scheduled) messages
-// use NewQueue() factory function instead of manually initializing
+// use PushAt() / PushIn() for delayed (scheduled) messages
+// use NewQueue() or Client.NewQueue() factory functions instead of manually initializing
 type Queue struct {
-	isStopped   bool
-	activeTasks int
+	// reads counts reads of many priority levels, accessed atomically so kept 64-bit aligned
+	reads uint64
+	// sourceReads counts reads of queues reading groups or tenants, accessed atomically
+	sourceReads uint64
+
+	client        *Client
+	backoff       Backoff
+	driverTimeout time.Duration
+	taskTimeout   time.Duration
+	repanic       bool
+	minPoll       time.Duration
+	maxPoll       time.Duration
+	// priorities are the levels read, highest first
+	priorities      []int
+	starvationLimit int
+	// onExpired and expiredDeadLetters handle messages which expired before they could run
+	onExpired          func(c Context)
+	expiredDeadLetters bool
+	dedupWindow        time.Duration
+	uniqueTTL          time.Duration
+	rateLimit          float64
+	rateBurst          int
+	concurrency        int
+	slotLease          time.Duration
+	groups             bool
+	groupLease         time.Duration
+	fair               bool
+	tenantWeights      map[string]int
+	idGenerator        func() string
 
-	Workers  int8
-	Name     string
-	StopC    chan struct{}
-	stopExec chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	stopOnce sync.Once
+	workers  sync.WaitGroup
+	// ctx is done once Stop() is called, no more messages are read
+	ctx    context.Context
+	cancel context.CancelFunc
+	// runCtx is done once Stop() gives up waiting, running tasks are cancelled
+	runCtx context.Context
+	abort  context.CancelFunc
+
+	Workers int8
+	Name    string
+	StopC   chan struct{}
 }
 
-// Push to queue
+// Push to queue, an ID is assigned to messages without one
+// and kept as is through requeues
 func (q *Queue) Push(c Context) error {
-	c.SetID()
+	return q.PushContext(context.Background(), c)
+}
 
-	d, err := c.Marshal()
+// PushContext pushes to queue, giving up once ctx is done.
+// ErrDuplicateMessage is returned for messages with an idempotency key pushed within the dedup window,
+// the driver must implement Deduplicator for such messages. ErrUniqueJobLocked is returned for unique jobs
+// while another one with the same key is pending or running, the driver must implement UniqueLocker for those
+func (q *Queue) PushContext(ctx context.Context, c Context) error {
+	return q.push(ctx, c, time.Time{}, true)
+}
+
+// PushBatch pushes many messages at once, in a single round trip when the driver implements BatchWriter,
+// results match cs by index so messages which failed can be told apart
+func (q *Queue) PushBatch(cs []Context) []PushResult {
+	return q.PushBatchContext(context.Background(), cs)
+}
+
+// PushBatchContext pushes many messages at once, giving up once ctx is done
+func (q *Queue) PushBatchContext(ctx context.Context, cs []Context) []PushResult {
+	results := make([]PushResult, len(cs))
+	// undo the reservations of messages which are not written
+	undo := make([]func(), len(cs))
+
+	// messages are written a batch per priority level
+	var names []string
+	ds := map[string][][]byte{}
+	idx := map[string][]int{}
+
+	ctx, cancel := q.driverContext(ctx)
+	defer cancel()
+
+	for i, c := range cs {
+		if c.GetID() == "" {
+			q.setID(c)
+		}
+
+		results[i].ID = c.GetID()
+
+		name, err := q.queueName(c)
+
+		if err != nil {
+			results[i].Err = err
+
+			continue
+		}
+
+		d, err := c.Marshal()
+
+		if err != nil {
+			results[i].Err = err
+
+			continue
+		}
+
+		if undo[i], err = q.reserve(ctx, c, true); err != nil {
+			results[i].Err = err
+
+			continue
+		}
+
+		if group := groupKeyOf(c); group != "" {
+			results[i].Err = q.writeGroup(ctx, name, group, d)
+
+			continue
+		}
+
+		if tenant := tenantKeyOf(c); tenant != "" {
+			results[i].Err = q.writeTenant(ctx, name, tenant, d)
+
+			continue
+		}
+
+		if _, ok := ds[name]; !ok {
+			names = append(names, name)
+		}
+
+		ds[name] = append(ds[name], d)
+		idx[name] = append(idx[name], i)
+	}
+
+	for _, name := range names {
+		var errs []error
+
+		if w, ok := q.getDriver().(BatchWriter); ok {
+			errs = w.WriteBatch(ctx, name, ds[name])
+		} else {
+			for _, d := range ds[name] {
+				errs = append(errs, q.getDriver().Write(ctx, name, d))
+			}
+		}
+
+		for i, err := range errs {
+			results[idx[name][i]].Err = err
+		}
+	}
+
+	for i, fn := range undo {
+		if fn != nil && results[i].Err != nil {
+			fn()
+		}
+	}
+
+	return results
+}
+
+// PushAt pushes to queue to be executed at a given time,
+// the driver must implement Scheduler
+func (q *Queue) PushAt(c Context, at time.Time) error {
+	return q.PushAtContext(context.Background(), c, at)
+}
+
+// PushAtContext pushes to queue to be executed at a given time, giving up once ctx is done
+func (q *Queue) PushAtContext(ctx context.Context, c Context, at time.Time) error {
+	return q.push(ctx, c, at, true)
+}
+
+// PushIn pushes to queue to be executed after a given delay
+func (q *Queue) PushIn(c Context, d time.Duration) error {
+	return q.PushAt(c, time.Now().Add(d))
+}
+
+// Reschedule moves a pending or scheduled message to be executed at a given time, messages of groups
+// can not be rescheduled (ErrGroupedMessage). The driver must implement Rescheduler
+func (q *Queue) Reschedule(id string, at time.Time) error {
+	r, ok := q.getDriver().(Rescheduler)
+
+	if !ok {
+		return ErrNotSupported
+	}
+
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	var err error
+
+	for _, p := range q.getPriorities() {
+		if err = r.Reschedule(ctx, q.priorityName(p), id, at); err != ErrMessageNotFound {
+			return err
+		}
+	}
+
+	return err
+}
+
+// Delete removes a pending or scheduled message before it is executed and releases its unique job lock,
+// the driver must implement Rescheduler
+func (q *Queue) Delete(id string) error {
+	r, ok := q.getDriver().(Rescheduler)
+
+	if !ok {
+		return ErrNotSupported
+	}
+
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	for _, p := range q.getPriorities() {
+		d, err := r.Delete(ctx, q.priorityName(p), id)
+
+		if err == ErrMessageNotFound {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var m Message
+
+		if err := json.Unmarshal(d, &m); err == nil {
+			q.unlock(m.GetUniqueKey(), m.GetID())
+		}
+
+		return nil
+	}
+
+	return ErrMessageNotFound
+}
+
+// DeadLetters returns messages which failed max attempts, oldest failure first,
+// the driver must implement DeadLetterStore
+func (q *Queue) DeadLetters() ([]*DeadLetter, error) {
+	s, ok := q.getDriver().(DeadLetterStore)
+
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	ds, err := s.GetDeadLetters(ctx, q.getStatName())
+
+	if err != nil {
+		return nil, err
+	}
+
+	var letters = make([]*DeadLetter, 0, len(ds))
+
+	for _, d := range ds {
+		var l DeadLetter
+
+		if err := json.Unmarshal(d, &l); err != nil {
+			return nil, err
+		}
+
+		letters = append(letters, &l)
+	}
+
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+
+	return letters, nil
+}
+
+// DeadLetter returns a single message which failed max attempts
+func (q *Queue) DeadLetter(id string) (*DeadLetter, error) {
+	s, ok := q.getDriver().(DeadLetterStore)
+
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	d, err := s.GetDeadLetter(ctx, q.getStatName(), id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var l DeadLetter
+
+	if err := json.Unmarshal(d, &l); err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// ReplayDeadLetter pushes a dead-lettered message back into the queue with its attempts reset
+func (q *Queue) ReplayDeadLetter(id string) error {
+	l, err := q.DeadLetter(id)
 
 	if err != nil {
 		return err
 	}
 
-	return driver.Write(q.getActiveName(), d)
+	l.Message.Attempts = 0
+
+	if err := q.push(context.Background(), l.Message, time.Time{}, false); err != nil {
+		return err
+	}
+
+	return q.DeleteDeadLetter(id)
+}
+
+// DeleteDeadLetter removes a message which failed max attempts for good
+func (q *Queue) DeleteDeadLetter(id string) error {
+	s, ok := q.getDriver().(DeadLetterStore)
+
+	if !ok {
+		return ErrNotSupported
+	}
+
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	return s.DeleteDeadLetter(ctx, q.getStatName(), id)
 }
 
 // OnExec is triggered when there is a new message in th queue
 func (q *Queue) OnExec(task Task) {
-	ticker := time.NewTicker(100 * time.Millisecond)
-
-	for i := int8(0); i < q.Workers; i++ {
-		go func() {
-			for {
-				if q.isStopped {
-					return
-				}
-
-				select {
-				case <-ticker.C:
-					q.read(task)
-				}
-			}
-		}()
+	q.OnExecContext(contextTask{task})
+}
+
+// OnExecContext is OnExec for tasks receiving a context,
+// it is cancelled once Stop() gives up waiting for the task
+func (q *Queue) OnExecContext(task ContextTask) {
+	q.start(func() {
+		ready := make(chan struct{})
+		msgs := make(chan delivery)
+
+		q.workers.Add(int(q.Workers) + 1)
+		go q.dispatch(ready, msgs)
+
+		for i := int8(0); i < q.Workers; i++ {
+			go q.work(task, ready, msgs)
+		}
+	})
+}
+
+// OnExecBatch hands messages to task in batches of up to size messages,
+// each worker waits at most wait for a batch to fill once its first message is read
+func (q *Queue) OnExecBatch(task BatchTask, size int, wait time.Duration) {
+	if size < 1 {
+		size = 1
 	}
+
+	q.start(func() {
+		q.workers.Add(int(q.Workers))
+
+		for i := int8(0); i < q.Workers; i++ {
+			go q.workBatch(task, size, wait)
+		}
+	})
 }
 
-// Requeue pushes the task back in into queue until max attempts reached
+// Requeue pushes the task back in into queue until max attempts reached,
+// it is held back for the queue's backoff delay when the driver implements Scheduler.
+// Grouped messages can not be requeued (ErrGroupedMessage) as the copy would break the order of
+// their group, their task should return an error instead to be retried at the head of the group
 func (q *Queue) Requeue(c Context) error {
+	if groupKeyOf(c) != "" {
+		return ErrGroupedMessage
+	}
+
 	c.NewAttempt()
+	attempts := c.GetAttempts()
 
-	if c.GetAttempts() > c.GetMaxAttempts() {
+	if attempts > c.GetMaxAttempts() {
 		return fmt.Errorf("max attempts reached for %s:%s", q.Name, c.GetID())
 	}
 
-	return q.Push(c)
+	// the message has been pushed already, its idempotency key is not claimed again
+	if _, ok := q.getDriver().(Scheduler); ok {
+		return q.push(context.Background(), c, time.Now().Add(q.getBackoff().Delay(attempts)), false)
+	}
+
+	return q.push(context.Background(), c, time.Time{}, false)
 }
 
-// Stop queue from being executed
-func (q *Queue) Stop() {
-	q.isStopped = true
+// push writes c to the queue or schedules it when at is in the future,
+// fresh is false for messages which have been pushed before (retries, replays)
+func (q *Queue) push(ctx context.Context, c Context, at time.Time, fresh bool) error {
+	s, ok := q.getDriver().(Scheduler)
+	delayed := at.After(time.Now())
+
+	if delayed && !ok {
+		return ErrNotSupported
+	}
+
+	if c.GetID() == "" {
+		q.setID(c)
+	}
+
+	name, err := q.queueName(c)
+
+	if err != nil {
+		return err
+	}
+
+	d, err := c.Marshal()
+
+	if err != nil {
+		return err
+	}
+
+	group := groupKeyOf(c)
+	tenant := tenantKeyOf(c)
+
+	if group != "" && delayed {
+		return fmt.Errorf("%w: grouped messages can not be scheduled", ErrNotSupported)
+	}
+
+	// scheduled messages of tenants are promoted to their tenant, which only queues with fair dispatch read
+	if tenant != "" {
+		if _, err := q.tenantStore(); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := q.driverContext(ctx)
+	defer cancel()
 
-	if q.activeTasks > 0 {
-		<-time.NewTicker(time.Millisecond).C
-		q.Stop()
+	undo, err := q.reserve(ctx, c, fresh)
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case group != "":
+		err = q.writeGroup(ctx, name, group, d)
+	case delayed:
+		err = s.Schedule(ctx, name, d, at)
+	case tenant != "":
+		err = q.writeTenant(ctx, name, tenant, d)
+	default:
+		err = q.getDriver().Write(ctx, name, d)
+	}
+
+	if err != nil {
+		undo()
+	}
+
+	return err
+}
+
+// setID gives c an ID of the queue's generator, c generates its own when there is none
+func (q *Queue) setID(c Context) {
+	if a, ok := c.(assignable); ok && q.idGenerator != nil {
+		a.AssignID(q.idGenerator())
 
 		return
 	}
 
-	close(q.StopC)
+	c.SetID()
 }
 
-func (q *Queue) read(task Task) {
-	if d, err := driver.Read(q.getActiveName()); err != nil && err != redis.Nil {
-		logger.Warn(err)
-	} else if len(d) > 0 {
-		var m Message
-		var qName = fmt.Sprintf("%s:%s", queuePrefix, q.Name)
+// writeGroup writes to the tail of a message group
+func (q *Queue) writeGroup(ctx context.Context, queue string, group string, d []byte) error {
+	gs, ok := q.getDriver().(GroupStore)
 
-		if err := json.Unmarshal(d, &m); err != nil {
-			logger.Warn(err)
+	if !ok {
+		return ErrNotSupported
+	}
 
-			return
-		}
+	if !q.groups {
+		return ErrGroupsDisabled
+	}
 
-		logger.Info(fmt.Sprintf("[Processing] queue %v, task ID: %v", q.Name, m.GetID()))
-		q.activeTasks++
-		if err := task.Run(&m); err != nil {
-			task.Fail(err)
-			_ = driver.SetFailed(qName, m.GetID())
-			logger.Warn(fmt.Sprintf("[Failed] queue %v, task ID: %v", q.Name, m.GetID()))
-		} else {
-			_ = driver.SetProcessed(qName)
-			logger.Info(fmt.Sprintf("[Processed] queue %v, task ID: %v", q.Name, m.GetID()))
-		}
-		q.activeTasks--
+	return gs.WriteGroup(ctx, queue, group, d)
+}
+
+// writeTenant writes to the tail of a tenant
+func (q *Queue) writeTenant(ctx context.Context, queue string, tenant string, d []byte) error {
+	ts, err := q.tenantStore()
+
+	if err != nil {
+		return err
 	}
+
+	return ts.WriteTenant(ctx, queue, tenant, d)
 }
 
-func (q *Queue) getActiveName() string {
-	return fmt.Sprintf("%s:active:%s", queuePrefix, q.Name)
+// tenantStore returns the driver's TenantStore, an error is returned when the queue does not read tenants
+func (q *Queue) tenantStore() (TenantStore, error) {
+	ts, ok := q.getDriver().(TenantStore)
+
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	if !q.fair {
+		return nil, ErrFairDispatchDisabled
+	}
+
+	return ts, nil
+}
+
+// reserve claims the idempotency key of a fresh message and takes (or refreshes) the lock of a unique job,
+// the returned func undoes what a fresh message reserved once it could not be written
+func (q *Queue) reserve(ctx context.Context, c Context, fresh bool) (func(), error) {
+	var undo []func()
+
+	if key := idempotencyKeyOf(c); fresh && key != "" {
+		if err := q.claim(ctx, key); err != nil {
+			return nil, err
+		}
+
+		undo = append(undo, func() { q.release(key) })
+	}
+
+	if key := uniqueKeyOf(c); key != "" {
+		if err := q.lock(ctx, key, c.GetID()); err != nil {
+			for _, fn := range undo {
+				fn()
+			}
+
+			return nil, err
+		}
+
+		if fresh {
+			undo = append(undo, func() { q.unlock(key, c.GetID()) })
+		}
+	}
+
+	return func() {
+		for _, fn := range undo {
+			fn()
+		}
+	}, nil
+}
+
+// claim claims an idempotency key for the dedup window,
+// ErrDuplicateMessage is returned when it has been claimed already
+func (q *Queue) claim(ctx context.Context, key string) error {
+	dd, ok := q.getDriver().(Deduplicator)
+
+	if !ok {
+		return ErrNotSupported
+	}
+
+	claimed, err := dd.Claim(ctx, q.getStatName(), key, q.getDedupWindow())
+
+	if err != nil {
+		return err
+	}
+
+	if !claimed {
+		return fmt.Errorf("%w: %s", ErrDuplicateMessage, key)
+	}
+
+	return nil
+}
+
+// lock takes the lock of a unique job for the unique TTL,
+// ErrUniqueJobLocked is returned when another message holds it
+func (q *Queue) lock(ctx context.Context, key string, id string) error {
+	l, ok := q.getDriver().(UniqueLocker)
+
+	if !ok {
+		return ErrNotSupported
+	}
+
+	locked, err := l.Lock(ctx, q.getStatName(), key, id, q.getUniqueTTL())
+
+	if err != nil {
+		return err
+	}
+
+	if !locked {
+		return fmt.Errorf("%w: %s", ErrUniqueJobLocked, key)
+	}
+
+	return nil
+}
+
+// unlock releases the lock of a unique job once it completed or finally failed
+func (q *Queue) unlock(key string, id string) {
+	l, ok := q.getDriver().(UniqueLocker)
+
+	if !ok || key == "" {
+		return
+	}
+
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	if err := l.Unlock(ctx, q.getStatName(), key, id); err != nil {
+		q.getLogger().Warn(fmt.Sprintf("Failed to unlock unique job, %v", err))
+	}
+}
+
+// release releases the idempotency key of a message which could not be pushed so it can be pushed again
+func (q *Queue) release(key string) {
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	if err := q.getDriver().(Deduplicator).Release(ctx, q.getStatName(), key); err != nil {
+		q.getLogger().Warn(fmt.Sprintf("Failed to release idempotency key, %v", err))
+	}
+}
+
+// Stop stops reading messages and waits for running tasks until ctx is done,
+// tasks still running by then are cancelled and their messages handed back to the queue.
+// StopC is closed once every worker has returned, ctx.Err() is returned when the wait was cut short
+func (q *Queue) Stop(ctx context.Context) error {
+	q.getContext()
+
+	q.mu.Lock()
+	q.cancel()
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	var err error
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		q.abort()
+		<-done
+	}
+
+	q.stopOnce.Do(func() {
+		close(q.StopC)
+	})
+
+	return err
+}
+
+// delivery is a read message along with the driver queue (priority level), group and tenant it was read from
+type delivery struct {
+	queue  string
+	group  string
+	tenant string
+	d      []byte
+}
+
+// dispatch reads a message each time a worker is ready and hands it over
+func (q *Queue) dispatch(ready <-chan struct{}, msgs chan<- delivery) {
+	defer q.workers.Done()
+
+	ctx := q.getContext()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ready:
+		}
+
+		dl, ok := q.fetch(ctx)
+
+		if !ok {
+			return
+		}
+
+		select {
+		case msgs <- dl:
+		case <-ctx.Done():
+			q.nack(dl)
+
+			return
+		}
+	}
+}
+
+// work handles messages handed over by dispatch until the queue is stopped
+func (q *Queue) work(task ContextTask, ready chan<- struct{}, msgs <-chan delivery) {
+	defer q.workers.Done()
+
+	ctx := q.getContext()
+
+	for {
+		select {
+		case ready <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		select {
+		case dl := <-msgs:
+			q.handle(task, dl)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// workBatch reads batches of messages and hands them to task until the queue is stopped
+func (q *Queue) workBatch(task BatchTask, size int, wait time.Duration) {
+	defer q.workers.Done()
+
+	ctx := q.getContext()
+
+	for {
+		dl, ok := q.fetch(ctx)
+
+		if !ok {
+			return
+		}
+
+		dls := []delivery{dl}
+		wctx, cancel := context.WithTimeout(ctx, wait)
+
+		for len(dls) < size {
+			if dl, ok = q.fetch(wctx); !ok {
+				break
+			}
+
+			dls = append(dls, dl)
+		}
+
+		cancel()
+		q.handleBatch(task, dls)
+	}
+}
+
+// fetch reads the next message, blocking on drivers implementing BlockingReader and pausing
+// between reads of an empty queue otherwise, false is returned once ctx is done
+func (q *Queue) fetch(ctx context.Context) (delivery, bool) {
+	b, blocking := q.getDriver().(BlockingReader)
+	// blocking on a single level would hold messages of the others and of groups back
+	blocking = blocking && len(q.getPriorities()) == 1 && !q.groups && !q.fair
+	var idle time.Duration
+
+	for {
+		rctx, cancel := q.driverContext(ctx)
+
+		var dl delivery
+		var err error
+
+		if blocking {
+			dl.queue = q.getActiveName()
+			dl.d, err = b.ReadBlocking(rctx, dl.queue, blockTimeout)
+		} else {
+			dl, err = q.read(rctx)
+		}
+
+		cancel()
+
+		switch {
+		case err == nil && len(dl.d) > 0:
+			return dl, true
+		case ctx.Err() != nil:
+			return delivery{}, false
+		case err == ErrNotSupported && blocking:
+			blocking = false
+
+			continue
+		case err == redis.Nil && blocking:
+			continue
+		case err != nil && err != redis.Nil:
+			q.getLogger().Warn(err)
+		}
+
+		idle = q.nextPoll(idle)
+		timer := time.NewTimer(idle)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return delivery{}, false
+		case <-timer.C:
+		}
+	}
+}
+
+// read reads a message from the first non empty priority level, see readOrder(),
+// queues reading groups or tenants take turns between grouped, tenant and other messages
+func (q *Queue) read(ctx context.Context) (delivery, error) {
+	levels := q.readOrder()
+	names := make([]string, len(levels))
+
+	for i, p := range levels {
+		names[i] = q.priorityName(p)
+	}
+
+	sources := []func(ctx context.Context, names []string) (delivery, error){q.readLevels}
+
+	if gs, ok := q.getDriver().(GroupStore); ok && q.groups {
+		sources = append(sources, func(ctx context.Context, names []string) (delivery, error) {
+			return q.readGroups(ctx, gs, names)
+		})
+	}
+
+	if ts, ok := q.getDriver().(TenantStore); ok && q.fair {
+		sources = append(sources, func(ctx context.Context, names []string) (delivery, error) {
+			return q.readTenants(ctx, ts, names)
+		})
+	}
+
+	if len(sources) == 1 {
+		return q.readLevels(ctx, names)
+	}
+
+	first := int(atomic.AddUint64(&q.sourceReads, 1) % uint64(len(sources)))
+
+	for i := range sources {
+		if dl, err := sources[(first+i)%len(sources)](ctx, names); err != redis.Nil {
+			return dl, err
+		}
+	}
+
+	return delivery{}, redis.Nil
+}
+
+// readTenants reads a message of the next ready tenant of the first priority level having one
+func (q *Queue) readTenants(ctx context.Context, ts TenantStore, names []string) (delivery, error) {
+	for _, name := range names {
+		tenant, d, err := ts.ReadTenant(ctx, name, q.tenantWeights)
+
+		if err == redis.Nil {
+			continue
+		}
+
+		return delivery{queue: name, tenant: tenant, d: d}, err
+	}
+
+	return delivery{}, redis.Nil
+}
+
+// readGroups reads a message of the next ready group of the first priority level having one
+func (q *Queue) readGroups(ctx context.Context, gs GroupStore, names []string) (delivery, error) {
+	for _, name := range names {
+		group, d, err := gs.ReadGroup(ctx, name, q.getGroupLease())
+
+		if err == redis.Nil {
+			continue
+		}
+
+		return delivery{queue: name, group: group, d: d}, err
+	}
+
+	return delivery{}, redis.Nil
+}
+
+// readLevels reads a message from the first non empty of names
+func (q *Queue) readLevels(ctx context.Context, names []string) (delivery, error) {
+	if r, ok := q.getDriver().(PriorityReader); ok && len(names) > 1 {
+		i, d, err := r.ReadFirst(ctx, names)
+
+		if err != nil {
+			return delivery{}, err
+		}
+
+		return delivery{queue: names[i], d: d}, nil
+	}
+
+	for _, name := range names {
+		d, err := q.getDriver().Read(ctx, name)
+
+		if err == redis.Nil || (err == nil && len(d) == 0) {
+			continue
+		}
+
+		return delivery{queue: name, d: d}, err
+	}
+
+	return delivery{}, redis.Nil
+}
+
+// readOrder returns the priority levels in the order they are read, highest first
+// unless the read is due to prefer a lower level per the starvation limit
+func (q *Queue) readOrder() []int {
+	levels := q.getPriorities()
+
+	if q.starvationLimit <= 0 || len(levels) < 2 {
+		return levels
+	}
+
+	n := atomic.AddUint64(&q.reads, 1)
+	every := uint64(q.starvationLimit) + 1
+
+	if n%every != 0 {
+		return levels
+	}
+
+	// rotate through the lower levels, falling back to the higher ones once they are empty
+	start := 1 + int((n/every-1)%uint64(len(levels)-1))
+
+	return append(append([]int{}, levels[start:]...), levels[:start]...)
+}
+
+// handle runs task for a read message, then acks, retries or fails it
+func (q *Queue) handle(task ContextTask, dl delivery) {
+	ctx := q.getContext()
+	runCtx := q.runCtx
+
+	var m Message
+
+	if err := json.Unmarshal(dl.d, &m); err != nil {
+		q.getLogger().Warn(err)
+		// malformed message can never be processed, drop it
+		q.ack(dl)
+
+		return
+	}
+
+	if ctx.Err() != nil {
+		q.nack(dl)
+
+		return
+	}
+
+	if m.Expired(time.Now()) {
+		q.expire(&m, dl)
+
+		return
+	}
+
+	// the group must stay locked while waiting for a rate token or a slot too
+	stop := q.renewGroups([]delivery{dl})
+
+	if !q.throttle(ctx) {
+		stop()
+		q.nack(dl)
+
+		return
+	}
+
+	release, ok := q.acquire(ctx)
+
+	if !ok {
+		stop()
+		q.nack(dl)
+
+		return
+	}
+
+	q.getLogger().Info(fmt.Sprintf("[Processing] queue %v, task ID: %v", q.Name, m.GetID()))
+	done, err := q.run(runCtx, task, &m)
+	// an abandoned task keeps its slot until it returns
+	after(done, release)
+
+	var pe *PanicError
+
+	if q.repanic && errors.As(err, &pe) {
+		stop()
+		// hand the message to another consumer before crashing
+		q.nack(dl)
+		panic(pe)
+	}
+
+	settle := func() {
+		stop()
+
+		if err != nil && runCtx.Err() != nil {
+			// the task was cut short by Stop(), hand it to another consumer
+			q.nack(dl)
+
+			return
+		}
+
+		q.complete(task.Fail, &m, dl, err)
+	}
+
+	if dl.group != "" {
+		// the group stays locked until an abandoned task returns so the next message can not overtake it
+		after(done, settle)
+
+		return
+	}
+
+	settle()
+}
+
+// handleBatch runs task for read messages, then acks, retries or fails each of them
+func (q *Queue) handleBatch(task BatchTask, dls []delivery) {
+	ctx := q.getContext()
+	runCtx := q.runCtx
+
+	var ms []*Message
+	var read []delivery
+
+	for _, dl := range dls {
+		var m Message
+
+		if err := json.Unmarshal(dl.d, &m); err != nil {
+			q.getLogger().Warn(err)
+			// malformed message can never be processed, drop it
+			q.ack(dl)
+
+			continue
+		}
+
+		if m.Expired(time.Now()) {
+			q.expire(&m, dl)
+
+			continue
+		}
+
+		ms = append(ms, &m)
+		read = append(read, dl)
+	}
+
+	if len(ms) == 0 {
+		return
+	}
+
+	if ctx.Err() != nil {
+		q.nackAll(read)
+
+		return
+	}
+
+	stop := q.renewGroups(read)
+
+	if !q.throttle(ctx) {
+		stop()
+		q.nackAll(read)
+
+		return
+	}
+
+	release, ok := q.acquire(ctx)
+
+	if !ok {
+		stop()
+		q.nackAll(read)
+
+		return
+	}
+
+	q.getLogger().Info(fmt.Sprintf("[Processing] queue %v, batch of %v messages", q.Name, len(ms)))
+	errs, done, err := q.runBatch(runCtx, task, ms)
+	after(done, release)
+
+	var pe *PanicError
+
+	if q.repanic && errors.As(err, &pe) {
+		stop()
+		q.nackAll(read)
+		panic(pe)
+	}
+
+	settle := func() {
+		stop()
+
+		if err != nil && runCtx.Err() != nil {
+			q.nackAll(read)
+
+			return
+		}
+
+		for i, m := range ms {
+			merr := err
+
+			if merr == nil && i < len(errs) {
+				merr = errs[i]
+			}
+
+			q.complete(task.Fail, m, read[i], merr)
+		}
+	}
+
+	for _, dl := range read {
+		if dl.group != "" {
+			// groups stay locked until an abandoned task returns
+			after(done, settle)
+
+			return
+		}
+	}
+
+	settle()
+}
+
+// complete acks a handled message, a failed one is retried or failed
+func (q *Queue) complete(onFail func(err error), m *Message, dl delivery, err error) {
+	if err != nil {
+		q.fail(onFail, m, dl, err)
+
+		return
+	}
+
+	q.setProcessed()
+	q.getLogger().Info(fmt.Sprintf("[Processed] queue %v, task ID: %v", q.Name, m.GetID()))
+	q.ack(dl)
+	q.unlock(m.GetUniqueKey(), m.GetID())
+}
+
+// throttle waits for a token of the queue's rate limit, false is returned once ctx is done first
+func (q *Queue) throttle(ctx context.Context) bool {
+	l, ok := q.getDriver().(RateLimiter)
+
+	if q.rateLimit <= 0 || !ok {
+		return true
+	}
+
+	var idle time.Duration
+
+	for {
+		rctx, cancel := q.driverContext(ctx)
+		wait, err := l.Take(rctx, q.getStatName(), q.rateLimit, q.getRateBurst())
+		cancel()
+
+		switch {
+		case err == nil && wait <= 0:
+			return true
+		case ctx.Err() != nil:
+			return false
+		case err != nil:
+			// the limit can not be checked, wait as for an empty queue rather than exceeding it
+			q.getLogger().Warn(fmt.Sprintf("Failed to take rate limit token, %v", err))
+			idle = q.nextPoll(idle)
+			wait = idle
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// acquire waits for a slot of the queue's concurrency limit, false is returned once ctx is done first.
+// The slot's lease is renewed until the returned func releases it
+func (q *Queue) acquire(ctx context.Context) (func(), bool) {
+	s, ok := q.getDriver().(Semaphore)
+
+	if q.concurrency <= 0 || !ok {
+		return func() {}, true
+	}
+
+	holder := uuid.New().String()
+	lease := q.getSlotLease()
+	var idle time.Duration
+
+	for {
+		rctx, cancel := q.driverContext(ctx)
+		acquired, err := s.AcquireSlot(rctx, q.getStatName(), holder, q.concurrency, lease)
+		cancel()
+
+		if err == nil && acquired {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return nil, false
+		}
+
+		if err != nil {
+			q.getLogger().Warn(fmt.Sprintf("Failed to acquire concurrency slot, %v", err))
+		}
+
+		idle = q.nextPoll(idle)
+		timer := time.NewTimer(idle)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil, false
+		case <-timer.C:
+		}
+	}
+
+	stop := q.renew("concurrency slot", lease, func(ctx context.Context) (bool, error) {
+		return s.AcquireSlot(ctx, q.getStatName(), holder, q.concurrency, lease)
+	})
+
+	return func() {
+		stop()
+
+		ctx, cancel := q.driverContext(context.Background())
+		defer cancel()
+
+		if err := s.ReleaseSlot(ctx, q.getStatName(), holder); err != nil {
+			q.getLogger().Warn(fmt.Sprintf("Failed to release concurrency slot, %v", err))
+		}
+	}, true
+}
+
+// renewGroups renews the leases of the groups of read messages until the returned func is called
+func (q *Queue) renewGroups(dls []delivery) func() {
+	var stops []func()
+
+	for _, dl := range dls {
+		if dl.group == "" {
+			continue
+		}
+
+		dl := dl
+		lease := q.getGroupLease()
+
+		stops = append(stops, q.renew("group", lease, func(ctx context.Context) (bool, error) {
+			return q.getDriver().(GroupStore).RenewGroup(ctx, dl.queue, dl.group, dl.d, lease)
+		}))
+	}
+
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// renew renews a lease by calling fn every third of it until the returned func is called
+func (q *Queue) renew(name string, lease time.Duration, fn func(ctx context.Context) (bool, error)) func() {
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+
+	go func() {
+		defer close(renewed)
+
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			ctx, cancel := q.driverContext(context.Background())
+			ok, err := fn(ctx)
+			cancel()
+
+			if err != nil || !ok {
+				q.getLogger().Warn(fmt.Sprintf("Failed to renew %v lease, %v", name, err))
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-renewed
+	}
+}
+
+// expire skips a message which expired before it could run instead of running it
+func (q *Queue) expire(m *Message, dl delivery) {
+	q.setExpired()
+	q.getLogger().Warn(fmt.Sprintf("[Expired] queue %v, task ID: %v", q.Name, m.GetID()))
+
+	if q.onExpired != nil {
+		if err := recovered(func() error {
+			q.onExpired(m)
+
+			return nil
+		}); err != nil {
+			q.getLogger().Warn(fmt.Sprintf("Failed to handle expired message, %v", err))
+		}
+	}
+
+	if s, ok := q.getDriver().(DeadLetterStore); ok && q.expiredDeadLetters {
+		q.deadLetter(s, m, ErrMessageExpired)
+	}
+
+	q.ack(dl)
+	q.unlock(m.GetUniqueKey(), m.GetID())
+}
+
+// run runs task bound to the message's timeout, the returned channel is closed once the task returned
+func (q *Queue) run(ctx context.Context, task ContextTask, m *Message) (<-chan struct{}, error) {
+	timeout := m.GetTimeout()
+
+	if timeout <= 0 {
+		timeout = q.taskTimeout
+	}
+
+	// an abandoned task keeps its own copy, m is requeued meanwhile
+	c := *m
+
+	done, err := q.exec(ctx, timeout, func(ctx context.Context) error {
+		return task.RunContext(ctx, &c)
+	})
+
+	if closed(done) {
+		*m = c
+	}
+
+	return done, err
+}
+
+// runBatch runs task bound to the queue's task timeout, errs is nil when the whole batch failed with err.
+// The returned channel is closed once the task returned
+func (q *Queue) runBatch(ctx context.Context, task BatchTask, ms []*Message) ([]error, <-chan struct{}, error) {
+	cs := make([]Context, len(ms))
+	// written by the task's goroutine, only read once it has finished
+	var errs []error
+
+	for i, m := range ms {
+		c := *m
+		cs[i] = &c
+	}
+
+	done, err := q.exec(ctx, q.taskTimeout, func(ctx context.Context) error {
+		errs = task.RunBatch(ctx, cs)
+
+		return nil
+	})
+
+	if !closed(done) || err != nil {
+		return nil, done, err
+	}
+
+	for i, m := range ms {
+		*m = *cs[i].(*Message)
+	}
+
+	return errs, done, nil
+}
+
+// exec calls fn bound to timeout, turning a panic into a PanicError. fn still running once it
+// times out or ctx is done is abandoned so it can not hold the worker forever, the returned channel
+// is closed once fn actually returned
+func (q *Queue) exec(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) (<-chan struct{}, error) {
+	tctx, cancel := context.WithCancel(ctx)
+
+	if timeout > 0 {
+		cancel()
+		tctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	defer cancel()
+
+	done := make(chan struct{})
+	errC := make(chan error, 1)
+
+	go func() {
+		err := recovered(func() error {
+			return fn(tctx)
+		})
+
+		close(done)
+		errC <- err
+	}()
+
+	var err error
+
+	select {
+	case err = <-errC:
+	case <-tctx.Done():
+		err = tctx.Err()
+	}
+
+	if err != nil && ctx.Err() == nil && tctx.Err() == context.DeadlineExceeded {
+		return done, fmt.Errorf("%w after %v", ErrTaskTimeout, timeout)
+	}
+
+	return done, err
+}
+
+// closed tells whether done is closed without waiting for it
+func closed(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// after calls fn once done is closed, in the background when it is not closed yet
+func after(done <-chan struct{}, fn func()) {
+	if closed(done) {
+		fn()
+
+		return
+	}
+
+	go func() {
+		<-done
+		fn()
+	}()
+}
+
+// fail retries a failed message until max attempts reached, then marks it as failed
+// and moves it to the dead letters when the driver implements DeadLetterStore
+func (q *Queue) fail(onFail func(err error), m *Message, dl delivery, err error) {
+	m.History = append(m.History, Attempt{Error: err.Error(), FailedAt: time.Now()})
+
+	if m.GetAttempts() < m.GetMaxAttempts() {
+		if rerr := q.retry(m, dl); rerr != nil {
+			q.getLogger().Warn(fmt.Sprintf("Failed to requeue, %v", rerr))
+			q.nack(dl)
+
+			return
+		}
+
+		q.getLogger().Warn(fmt.Sprintf("[Retrying] queue %v, task ID: %v, attempt %v, %v", q.Name, m.GetID(), m.GetAttempts(), err))
+
+		return
+	}
+
+	if ferr := recovered(func() error {
+		onFail(err)
+
+		return nil
+	}); ferr != nil {
+		q.getLogger().Warn(fmt.Sprintf("Failed to handle failed message, %v", ferr))
+	}
+
+	q.setFailed(m.GetID())
+	q.getLogger().Warn(fmt.Sprintf("[Failed] queue %v, task ID: %v", q.Name, m.GetID()))
+
+	if s, ok := q.getDriver().(DeadLetterStore); ok {
+		q.deadLetter(s, m, err)
+	}
+
+	q.ack(dl)
+	q.unlock(m.GetUniqueKey(), m.GetID())
+}
+
+// retry hands a failed message back to the queue, a grouped one stays at the head of its group
+// which is kept locked for the backoff delay so later messages of the group do not overtake it
+func (q *Queue) retry(m *Message, dl delivery) error {
+	if dl.group == "" {
+		if err := q.Requeue(m); err != nil {
+			return err
+		}
+
+		q.ack(dl)
+
+		return nil
+	}
+
+	m.NewAttempt()
+	d, err := m.Marshal()
+
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	at := time.Now().Add(q.getBackoff().Delay(m.GetAttempts()))
+
+	return q.getDriver().(GroupStore).NackGroup(ctx, dl.queue, dl.group, dl.d, d, at)
+}
+
+func (q *Queue) deadLetter(s DeadLetterStore, m *Message, err error) {
+	l, merr := json.Marshal(&DeadLetter{Message: m, Error: err.Error(), FailedAt: time.Now()})
+
+	if merr == nil {
+		ctx, cancel := q.driverContext(context.Background())
+		merr = s.AddDeadLetter(ctx, q.getStatName(), m.GetID(), l)
+		cancel()
+	}
+
+	if merr != nil {
+		q.getLogger().Warn(fmt.Sprintf("Failed to dead letter, %v", merr))
+	}
+}
+
+// promote moves due scheduled messages into the active queue until the queue is stopped
+func (q *Queue) promote(s Scheduler) {
+	defer q.workers.Done()
+
+	ticker := time.NewTicker(promoteInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, p := range q.getPriorities() {
+			ctx, cancel := q.driverContext(q.ctx)
+
+			if _, err := s.Promote(ctx, q.priorityName(p), time.Now()); err != nil && q.ctx.Err() == nil {
+				q.getLogger().Warn(fmt.Sprintf("Failed to promote scheduled messages, %v", err))
+			}
+
+			cancel()
+		}
+	}
+}
+
+// reap keeps the consumer of the driver alive and returns messages left in flight by dead consumers
+// to the queue until the queue is stopped
+func (q *Queue) reap(r InFlightReaper) {
+	defer q.workers.Done()
+
+	ticker := time.NewTicker(heartbeatTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		for _, p := range q.getPriorities() {
+			ctx, cancel := q.driverContext(q.ctx)
+
+			if n, err := r.Reap(ctx, q.priorityName(p)); err != nil && q.ctx.Err() == nil {
+				q.getLogger().Warn(fmt.Sprintf("Failed to reap in-flight messages, %v", err))
+			} else if n > 0 {
+				q.getLogger().Info(fmt.Sprintf("[Reaped] queue %v, %v messages of dead consumers", q.Name, n))
+			}
+
+			cancel()
+		}
+
+		select {
+		case <-q.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		q.heartbeat(r)
+	}
+}
+
+// heartbeat keeps the consumer of the driver alive for every priority level
+func (q *Queue) heartbeat(r InFlightReaper) {
+	for _, p := range q.getPriorities() {
+		ctx, cancel := q.driverContext(q.ctx)
+
+		if err := r.Heartbeat(ctx, q.priorityName(p), heartbeatTTL); err != nil && q.ctx.Err() == nil {
+			q.getLogger().Warn(fmt.Sprintf("Failed to send heartbeat, %v", err))
+		}
+
+		cancel()
+	}
+}
+
+// start runs the queue's workers with run unless the queue has been stopped
+func (q *Queue) start(run func()) {
+	ctx := q.getContext()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if s, ok := q.getDriver().(Scheduler); ok {
+		q.workers.Add(1)
+		go q.promote(s)
+	}
+
+	if r, ok := q.getDriver().(InFlightReaper); ok {
+		// the consumer is alive before it reads its first message
+		q.heartbeat(r)
+		q.workers.Add(1)
+		go q.reap(r)
+	}
+
+	if _, ok := q.getDriver().(RateLimiter); q.rateLimit > 0 && !ok {
+		q.getLogger().Error(fmt.Errorf("rate limit of queue %v is ignored, %w", q.Name, ErrNotSupported))
+	}
+
+	if _, ok := q.getDriver().(Semaphore); q.concurrency > 0 && !ok {
+		q.getLogger().Error(fmt.Errorf("concurrency limit of queue %v is ignored, %w", q.Name, ErrNotSupported))
+	}
+
+	run()
+}
+
+// nackAll hands every message of an unhandled batch back to the queue
+func (q *Queue) nackAll(dls []delivery) {
+	for _, dl := range dls {
+		q.nack(dl)
+	}
+}
+
+// setProcessed counts a handled message
+func (q *Queue) setProcessed() {
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	_ = q.getDriver().SetProcessed(ctx, q.getStatName())
+}
+
+// setFailed records a message which failed max attempts
+func (q *Queue) setFailed(id string) {
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	_ = q.getDriver().SetFailed(ctx, q.getStatName(), id)
+}
+
+// setExpired counts a message skipped as it expired when the driver implements ExpiryCounter
+func (q *Queue) setExpired() {
+	c, ok := q.getDriver().(ExpiryCounter)
+
+	if !ok {
+		return
+	}
+
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	_ = c.SetExpired(ctx, q.getStatName())
+}
+
+// ack removes a handled message from the driver's in-flight list,
+// it is not bound to the queue's context so it still runs once the queue is stopped
+func (q *Queue) ack(dl delivery) {
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	var err error
+
+	if dl.group != "" {
+		err = q.getDriver().(GroupStore).AckGroup(ctx, dl.queue, dl.group, dl.d)
+	} else {
+		err = q.getDriver().Ack(ctx, dl.queue, dl.d)
+	}
+
+	if err != nil {
+		q.getLogger().Warn(fmt.Sprintf("Failed to ack, %v", err))
+	}
+}
+
+// nack hands an unhandled message back to the queue
+func (q *Queue) nack(dl delivery) {
+	ctx, cancel := q.driverContext(context.Background())
+	defer cancel()
+
+	var err error
+
+	switch {
+	case dl.group != "":
+		err = q.getDriver().(GroupStore).NackGroup(ctx, dl.queue, dl.group, dl.d, dl.d, time.Now())
+	case dl.tenant != "":
+		err = q.getDriver().(TenantStore).NackTenant(ctx, dl.queue, dl.tenant, dl.d)
+	default:
+		err = q.getDriver().Nack(ctx, dl.queue, dl.d)
+	}
+
+	if err != nil {
+		q.getLogger().Warn(fmt.Sprintf("Failed to nack, %v", err))
+	}
+}
+
+func (q *Queue) getClient() *Client {
+	if q.client == nil {
+		return defaultClient
+	}
+
+	return q.client
+}
+
+func (q *Queue) getDriver() Driver {
+	return q.getClient().driver
+}
+
+func (q *Queue) getLogger() Logger {
+	return q.getClient().logger
+}
+
+// getContext returns the context cancelled once the queue is stopped
+func (q *Queue) getContext() context.Context {
+	q.once.Do(q.init)
+
+	return q.ctx
+}
+
+// init sets the queue's lifecycle up, queues may be created without NewQueue()
+func (q *Queue) init() {
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	q.runCtx, q.abort = context.WithCancel(context.Background())
+
+	if q.StopC == nil {
+		q.StopC = make(chan struct{})
+	}
+}
+
+// driverContext derives the context of a single driver call from ctx
+func (q *Queue) driverContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if q.driverTimeout > 0 {
+		return context.WithTimeout(ctx, q.driverTimeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// nextPoll doubles the pause between reads of an empty queue
+func (q *Queue) nextPoll(idle time.Duration) time.Duration {
+	min, max := q.minPoll, q.maxPoll
+
+	if min <= 0 {
+		min = defaultMinPoll
+	}
+
+	if max < min {
+		max = defaultMaxPoll
+	}
+
+	if idle *= 2; idle < min {
+		return min
+	}
+
+	if idle > max {
+		return max
+	}
+
+	return idle
+}
+
+func (q *Queue) getBackoff() Backoff {
+	if q.backoff == nil {
+		return defaultBackoff
+	}
+
+	return q.backoff
+}
+
+func (q *Queue) getDedupWindow() time.Duration {
+	if q.dedupWindow <= 0 {
+		return defaultDedupWindow
+	}
+
+	return q.dedupWindow
+}
+
+func (q *Queue) getUniqueTTL() time.Duration {
+	if q.uniqueTTL <= 0 {
+		return defaultUniqueTTL
+	}
+
+	return q.uniqueTTL
+}
+
+func (q *Queue) getGroupLease() time.Duration {
+	if q.groupLease <= 0 {
+		return defaultGroupLease
+	}
+
+	return q.groupLease
+}
+
+func (q *Queue) getSlotLease() time.Duration {
+	if q.slotLease <= 0 {
+		return defaultSlotLease
+	}
+
+	return q.slotLease
+}
+
+func (q *Queue) getRateBurst() int {
+	if q.rateBurst < 1 {
+		return 1
+	}
+
+	return q.rateBurst
+}
+
+func (q *Queue) getStatName() string {
+	return fmt.Sprintf("%s:%s", queuePrefix, q.Name)
+}
+
+func (q *Queue) getActiveName() string {
+	return fmt.Sprintf("%s:active:%s", queuePrefix, q.Name)
+}
+
+// getPriorities returns the priority levels read by the queue, highest first
+func (q *Queue) getPriorities() []int {
+	if len(q.priorities) == 0 {
+		return []int{0}
+	}
+
+	return q.priorities
+}
+
+// priorityName returns the driver queue of a priority level, the default level uses the active name
+func (q *Queue) priorityName(p int) string {
+	if p == 0 {
+		return q.getActiveName()
+	}
+
+	return fmt.Sprintf("%s:priority:%d", q.getActiveName(), p)
+}
+
+// queueName returns the driver queue c is written to by its priority
+func (q *Queue) queueName(c Context) (string, error) {
+	p := priorityOf(c)
+
+	if !containsInt(q.getPriorities(), p) {
+		return "", fmt.Errorf("%w: %d", ErrUnknownPriority, p)
+	}
+
+	return q.priorityName(p), nil
+}
+
+func containsInt(s []int, v int) bool {
+	for _, i := range s {
+		if i == v {
+			return true
+		}
+	}
+
+	return false
 }
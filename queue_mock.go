@@ -5,7 +5,9 @@
 package simpleq
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -33,6 +35,64 @@ func (m *MockQueueable) EXPECT() *MockQueueableMockRecorder {
 	return m.recorder
 }
 
+// DeadLetter mocks base method.
+func (m *MockQueueable) DeadLetter(id string) (*DeadLetter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeadLetter", id)
+	ret0, _ := ret[0].(*DeadLetter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeadLetter indicates an expected call of DeadLetter.
+func (mr *MockQueueableMockRecorder) DeadLetter(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeadLetter", reflect.TypeOf((*MockQueueable)(nil).DeadLetter), id)
+}
+
+// DeadLetters mocks base method.
+func (m *MockQueueable) DeadLetters() ([]*DeadLetter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeadLetters")
+	ret0, _ := ret[0].([]*DeadLetter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeadLetters indicates an expected call of DeadLetters.
+func (mr *MockQueueableMockRecorder) DeadLetters() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeadLetters", reflect.TypeOf((*MockQueueable)(nil).DeadLetters))
+}
+
+// Delete mocks base method.
+func (m *MockQueueable) Delete(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockQueueableMockRecorder) Delete(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockQueueable)(nil).Delete), id)
+}
+
+// DeleteDeadLetter mocks base method.
+func (m *MockQueueable) DeleteDeadLetter(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDeadLetter", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteDeadLetter indicates an expected call of DeleteDeadLetter.
+func (mr *MockQueueableMockRecorder) DeleteDeadLetter(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDeadLetter", reflect.TypeOf((*MockQueueable)(nil).DeleteDeadLetter), id)
+}
+
 // OnExec mocks base method.
 func (m *MockQueueable) OnExec(task Task) {
 	m.ctrl.T.Helper()
@@ -45,6 +105,30 @@ func (mr *MockQueueableMockRecorder) OnExec(task interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnExec", reflect.TypeOf((*MockQueueable)(nil).OnExec), task)
 }
 
+// OnExecBatch mocks base method.
+func (m *MockQueueable) OnExecBatch(task BatchTask, size int, wait time.Duration) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnExecBatch", task, size, wait)
+}
+
+// OnExecBatch indicates an expected call of OnExecBatch.
+func (mr *MockQueueableMockRecorder) OnExecBatch(task, size, wait interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnExecBatch", reflect.TypeOf((*MockQueueable)(nil).OnExecBatch), task, size, wait)
+}
+
+// OnExecContext mocks base method.
+func (m *MockQueueable) OnExecContext(task ContextTask) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnExecContext", task)
+}
+
+// OnExecContext indicates an expected call of OnExecContext.
+func (mr *MockQueueableMockRecorder) OnExecContext(task interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnExecContext", reflect.TypeOf((*MockQueueable)(nil).OnExecContext), task)
+}
+
 // Push mocks base method.
 func (m *MockQueueable) Push(t Context) error {
 	m.ctrl.T.Helper()
@@ -59,6 +143,104 @@ func (mr *MockQueueableMockRecorder) Push(t interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Push", reflect.TypeOf((*MockQueueable)(nil).Push), t)
 }
 
+// PushAt mocks base method.
+func (m *MockQueueable) PushAt(t Context, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PushAt", t, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PushAt indicates an expected call of PushAt.
+func (mr *MockQueueableMockRecorder) PushAt(t, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushAt", reflect.TypeOf((*MockQueueable)(nil).PushAt), t, at)
+}
+
+// PushAtContext mocks base method.
+func (m *MockQueueable) PushAtContext(ctx context.Context, t Context, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PushAtContext", ctx, t, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PushAtContext indicates an expected call of PushAtContext.
+func (mr *MockQueueableMockRecorder) PushAtContext(ctx, t, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushAtContext", reflect.TypeOf((*MockQueueable)(nil).PushAtContext), ctx, t, at)
+}
+
+// PushBatch mocks base method.
+func (m *MockQueueable) PushBatch(ts []Context) []PushResult {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PushBatch", ts)
+	ret0, _ := ret[0].([]PushResult)
+	return ret0
+}
+
+// PushBatch indicates an expected call of PushBatch.
+func (mr *MockQueueableMockRecorder) PushBatch(ts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushBatch", reflect.TypeOf((*MockQueueable)(nil).PushBatch), ts)
+}
+
+// PushBatchContext mocks base method.
+func (m *MockQueueable) PushBatchContext(ctx context.Context, ts []Context) []PushResult {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PushBatchContext", ctx, ts)
+	ret0, _ := ret[0].([]PushResult)
+	return ret0
+}
+
+// PushBatchContext indicates an expected call of PushBatchContext.
+func (mr *MockQueueableMockRecorder) PushBatchContext(ctx, ts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushBatchContext", reflect.TypeOf((*MockQueueable)(nil).PushBatchContext), ctx, ts)
+}
+
+// PushContext mocks base method.
+func (m *MockQueueable) PushContext(ctx context.Context, t Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PushContext", ctx, t)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PushContext indicates an expected call of PushContext.
+func (mr *MockQueueableMockRecorder) PushContext(ctx, t interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushContext", reflect.TypeOf((*MockQueueable)(nil).PushContext), ctx, t)
+}
+
+// PushIn mocks base method.
+func (m *MockQueueable) PushIn(t Context, d time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PushIn", t, d)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PushIn indicates an expected call of PushIn.
+func (mr *MockQueueableMockRecorder) PushIn(t, d interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PushIn", reflect.TypeOf((*MockQueueable)(nil).PushIn), t, d)
+}
+
+// ReplayDeadLetter mocks base method.
+func (m *MockQueueable) ReplayDeadLetter(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplayDeadLetter", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplayDeadLetter indicates an expected call of ReplayDeadLetter.
+func (mr *MockQueueableMockRecorder) ReplayDeadLetter(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplayDeadLetter", reflect.TypeOf((*MockQueueable)(nil).ReplayDeadLetter), id)
+}
+
 // Requeue mocks base method.
 func (m *MockQueueable) Requeue(t Context) error {
 	m.ctrl.T.Helper()
@@ -73,14 +255,30 @@ func (mr *MockQueueableMockRecorder) Requeue(t interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Requeue", reflect.TypeOf((*MockQueueable)(nil).Requeue), t)
 }
 
+// Reschedule mocks base method.
+func (m *MockQueueable) Reschedule(id string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reschedule", id, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reschedule indicates an expected call of Reschedule.
+func (mr *MockQueueableMockRecorder) Reschedule(id, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reschedule", reflect.TypeOf((*MockQueueable)(nil).Reschedule), id, at)
+}
+
 // Stop mocks base method.
-func (m *MockQueueable) Stop() {
+func (m *MockQueueable) Stop(ctx context.Context) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Stop")
+	ret := m.ctrl.Call(m, "Stop", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // Stop indicates an expected call of Stop.
-func (mr *MockQueueableMockRecorder) Stop() *gomock.Call {
+func (mr *MockQueueableMockRecorder) Stop(ctx interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockQueueable)(nil).Stop))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stop", reflect.TypeOf((*MockQueueable)(nil).Stop), ctx)
 }
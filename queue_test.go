@@ -1,10 +1,16 @@
 package simpleq
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/go-redis/redis"
 	"github.com/golang/mock/gomock"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 type TaskImpl struct{}
@@ -17,6 +23,21 @@ func (ti *TaskImpl) Fail(err error) {
 	fmt.Println(err)
 }
 
+type failingTask struct {
+	runs   chan struct{}
+	failed chan error
+}
+
+func (ft *failingTask) Run(c Context) error {
+	ft.runs <- struct{}{}
+
+	return fmt.Errorf("failed to run")
+}
+
+func (ft *failingTask) Fail(err error) {
+	ft.failed <- err
+}
+
 func TestNewQueue(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	d := NewMockDriver(ctrl)
@@ -31,8 +52,8 @@ func TestNewQueue(t *testing.T) {
 
 		d.
 			EXPECT().
-			Register(qName).
-			DoAndReturn(func(_ string) error {
+			Register(gomock.Any(), qName).
+			DoAndReturn(func(_ context.Context, _ string) error {
 				return fmt.Errorf("failed to register")
 			}).
 			Times(1)
@@ -43,8 +64,8 @@ func TestNewQueue(t *testing.T) {
 	t.Run("it_should_return_new_queue_instance", func(t *testing.T) {
 		d.
 			EXPECT().
-			Register(qName).
-			DoAndReturn(func(_ string) error {
+			Register(gomock.Any(), qName).
+			DoAndReturn(func(_ context.Context, _ string) error {
 				return nil
 			}).
 			Times(1)
@@ -52,10 +73,10 @@ func TestNewQueue(t *testing.T) {
 		lg.EXPECT().Info(gomock.Any()).Times(1)
 
 		expect := Queue{
-			Workers:  2,
-			Name:     "test-queue",
-			StopC:    nil,
-			stopExec: nil,
+			client:  defaultClient,
+			Workers: 2,
+			Name:    "test-queue",
+			StopC:   nil,
 		}
 
 		if got, err := NewQueue(qName, 2); err != nil {
@@ -63,14 +84,24 @@ func TestNewQueue(t *testing.T) {
 		} else {
 			// Delete channels
 			got.StopC = nil
-			got.stopExec = nil
 
 			if !reflect.DeepEqual(&expect, got) {
-				t.Errorf("Expected NewQueue() to retutn %v, got %v", expect, got)
+				t.Errorf("Expected NewQueue() to retutn %v, got %v", &expect, got)
 			}
 
 		}
 	})
+
+	t.Run("it_should_apply_options", func(t *testing.T) {
+		d.EXPECT().Register(gomock.Any(), qName).Times(1)
+		lg.EXPECT().Info(gomock.Any()).Times(1)
+
+		b := ConstantBackoff(time.Second)
+
+		if got, _ := NewQueue(qName, 2, WithBackoff(b)); got.getBackoff().Delay(1) != time.Second {
+			t.Errorf("Expected NewQueue() to set backoff")
+		}
+	})
 }
 
 func TestQueue_Push(t *testing.T) {
@@ -78,18 +109,17 @@ func TestQueue_Push(t *testing.T) {
 	c := NewMockContext(ctrl)
 	d := NewMockDriver(ctrl)
 
-	Init(d, &DefaultLogger{})
-
 	queue := Queue{
-		Workers:  1,
-		Name:     "test-queue",
-		StopC:    make(chan struct{}),
-		stopExec: make(chan struct{}),
+		client:  NewClient(d, &DefaultLogger{}),
+		Workers: 1,
+		Name:    "test-queue",
+		StopC:   make(chan struct{}),
 	}
 
 	t.Run("it_should_return_error_when_it_fails_to_marshal_context", func(t *testing.T) {
 		expect := fmt.Errorf("failed to marshal")
 
+		c.EXPECT().GetID().Return("").Times(1)
 		c.EXPECT().SetID().Times(1)
 
 		c.
@@ -108,6 +138,7 @@ func TestQueue_Push(t *testing.T) {
 	t.Run("it_should_return_error_when_it_fails_to_save_data", func(t *testing.T) {
 		expect := fmt.Errorf("failed to write")
 
+		c.EXPECT().GetID().Return("").Times(1)
 		c.EXPECT().SetID().Times(1)
 
 		c.
@@ -120,8 +151,8 @@ func TestQueue_Push(t *testing.T) {
 
 		d.
 			EXPECT().
-			Write("simple-queue:data:active:test-queue", []byte("test-data")).
-			DoAndReturn(func(_ string, _ []byte) error {
+			Write(gomock.Any(), "simple-queue:data:active:test-queue", []byte("test-data")).
+			DoAndReturn(func(_ context.Context, _ string, _ []byte) error {
 				return fmt.Errorf("failed to write")
 			}).
 			Times(1)
@@ -130,60 +161,41 @@ func TestQueue_Push(t *testing.T) {
 			t.Errorf("Expected Push() to return error %v, got %v", expect, err)
 		}
 	})
+
+	t.Run("it_should_keep_existing_id", func(t *testing.T) {
+		c.EXPECT().GetID().Return("test-id").Times(1)
+		c.EXPECT().SetID().Times(0)
+		c.EXPECT().Marshal().Return([]byte("test-data"), nil).Times(1)
+
+		d.EXPECT().Write(gomock.Any(), "simple-queue:data:active:test-queue", []byte("test-data")).Times(1)
+
+		if err := queue.Push(c); err != nil {
+			t.Errorf("Expected Push() to push, got error %v", err)
+		}
+	})
 }
 
-func TestQueue_read(t *testing.T) {
+func TestQueue_handle(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	d := NewMockDriver(ctrl)
 	dl := NewMockLogger(ctrl)
 	task := NewMockTask(ctrl)
 
 	queue := Queue{
-		Workers:  3,
-		Name:     "test-queue",
-		StopC:    make(chan struct{}),
-		stopExec: make(chan struct{}),
+		client:  NewClient(d, dl),
+		Workers: 3,
+		Name:    "test-queue",
+		StopC:   make(chan struct{}),
 	}
 
-	Init(d, dl)
-
-	t.Run("it_should_log_error_when_it_fails_to_read_data", func(t *testing.T) {
-		d.
-			EXPECT().
-			Read("simple-queue:data:active:test-queue").
-			DoAndReturn(func(_ string) ([]byte, error) {
-				return nil, fmt.Errorf("failed to read")
-			}).
-			Times(1)
-
-		dl.EXPECT().Warn(fmt.Errorf("failed to read")).Times(1)
-
-		queue.read(new(TaskImpl))
-	})
-
 	t.Run("it_should_log_warning_when_it_fails_to_unmarshal_data", func(t *testing.T) {
-		d.
-			EXPECT().
-			Read("simple-queue:data:active:test-queue").
-			DoAndReturn(func(_ string) ([]byte, error) {
-				return []byte("{"), nil
-			}).
-			Times(1)
-
 		dl.EXPECT().Warn(gomock.Any()).Times(1)
+		d.EXPECT().Ack(gomock.Any(), "simple-queue:data:active:test-queue", []byte("{")).Times(1)
 
-		queue.read(new(TaskImpl))
+		queue.handle(contextTask{new(TaskImpl)}, delivery{queue: queue.getActiveName(), d: []byte("{")})
 	})
 
 	t.Run("it_should_call_fail_when_task_run_returns_an_error", func(t *testing.T) {
-		d.
-			EXPECT().
-			Read("simple-queue:data:active:test-queue").
-			DoAndReturn(func(_ string) ([]byte, error) {
-				return []byte("{}"), nil
-			}).
-			Times(1)
-
 		task.
 			EXPECT().
 			Run(gomock.Any()).
@@ -193,22 +205,38 @@ func TestQueue_read(t *testing.T) {
 			Times(1)
 
 		task.EXPECT().Fail(fmt.Errorf("failed to run")).Times(1)
-		d.EXPECT().SetFailed("simple-queue:data:test-queue", gomock.Any()).Times(1)
+		d.EXPECT().SetFailed(gomock.Any(), "simple-queue:data:test-queue", gomock.Any()).Times(1)
 		dl.EXPECT().Info(gomock.Any()).Times(1)
 		dl.EXPECT().Warn(gomock.Any()).Times(1)
+		d.EXPECT().Ack(gomock.Any(), "simple-queue:data:active:test-queue", []byte("{}")).Times(1)
 
-		queue.read(task)
+		queue.handle(contextTask{task}, delivery{queue: queue.getActiveName(), d: []byte("{}")})
 	})
 
-	t.Run("it_should_call_run", func(t *testing.T) {
-		d.
-			EXPECT().
-			Read("simple-queue:data:active:test-queue").
-			DoAndReturn(func(_ string) ([]byte, error) {
-				return []byte("{}"), nil
-			}).
-			Times(1)
+	t.Run("it_should_retry_when_attempts_remain", func(t *testing.T) {
+		task.EXPECT().Run(gomock.Any()).Return(fmt.Errorf("failed to run")).Times(1)
+		task.EXPECT().Fail(gomock.Any()).Times(0)
+
+		d.EXPECT().Write(gomock.Any(), "simple-queue:data:active:test-queue", gomock.Any()).Times(1)
+		d.EXPECT().Ack(gomock.Any(), "simple-queue:data:active:test-queue", []byte(`{"max_attempts":1}`)).Times(1)
+		dl.EXPECT().Info(gomock.Any()).Times(1)
+		dl.EXPECT().Warn(gomock.Any()).Times(1)
 
+		queue.handle(contextTask{task}, delivery{queue: queue.getActiveName(), d: []byte(`{"max_attempts":1}`)})
+	})
+
+	t.Run("it_should_nack_when_it_fails_to_retry", func(t *testing.T) {
+		task.EXPECT().Run(gomock.Any()).Return(fmt.Errorf("failed to run")).Times(1)
+
+		d.EXPECT().Write(gomock.Any(), "simple-queue:data:active:test-queue", gomock.Any()).Return(fmt.Errorf("failed to write")).Times(1)
+		d.EXPECT().Nack(gomock.Any(), "simple-queue:data:active:test-queue", []byte(`{"max_attempts":1}`)).Times(1)
+		dl.EXPECT().Info(gomock.Any()).Times(1)
+		dl.EXPECT().Warn("Failed to requeue, failed to write").Times(1)
+
+		queue.handle(contextTask{task}, delivery{queue: queue.getActiveName(), d: []byte(`{"max_attempts":1}`)})
+	})
+
+	t.Run("it_should_call_run", func(t *testing.T) {
 		task.
 			EXPECT().
 			Run(gomock.Any()).
@@ -219,8 +247,38 @@ func TestQueue_read(t *testing.T) {
 
 		dl.EXPECT().Info(gomock.Any()).Times(2)
 
-		d.EXPECT().SetProcessed("simple-queue:data:test-queue").Times(1)
-		queue.read(task)
+		d.EXPECT().SetProcessed(gomock.Any(), "simple-queue:data:test-queue").Times(1)
+		d.EXPECT().Ack(gomock.Any(), "simple-queue:data:active:test-queue", []byte("{}")).Times(1)
+		queue.handle(contextTask{task}, delivery{queue: queue.getActiveName(), d: []byte("{}")})
+	})
+
+	t.Run("it_should_log_warning_when_it_fails_to_ack", func(t *testing.T) {
+		task.EXPECT().Run(gomock.Any()).Return(nil).Times(1)
+
+		dl.EXPECT().Info(gomock.Any()).Times(2)
+		dl.EXPECT().Warn("Failed to ack, failed to ack").Times(1)
+
+		d.EXPECT().SetProcessed(gomock.Any(), "simple-queue:data:test-queue").Times(1)
+		d.
+			EXPECT().
+			Ack(gomock.Any(), "simple-queue:data:active:test-queue", []byte("{}")).
+			Return(fmt.Errorf("failed to ack")).
+			Times(1)
+
+		queue.handle(contextTask{task}, delivery{queue: queue.getActiveName(), d: []byte("{}")})
+	})
+
+	t.Run("it_should_nack_when_queue_is_stopped", func(t *testing.T) {
+		stopped := Queue{
+			client:  queue.client,
+			Workers: 1,
+			Name:    "test-queue",
+		}
+		_ = stopped.Stop(context.Background())
+
+		d.EXPECT().Nack(gomock.Any(), "simple-queue:data:active:test-queue", []byte("{}")).Times(1)
+
+		stopped.handle(contextTask{task}, delivery{queue: stopped.getActiveName(), d: []byte("{}")})
 	})
 }
 
@@ -230,13 +288,11 @@ func TestQueue_Requeue(t *testing.T) {
 	d := NewMockDriver(ctrl)
 	lg := NewMockLogger(ctrl)
 
-	Init(d, lg)
-
 	queue := Queue{
-		Workers:  1,
-		Name:     "test-queue",
-		StopC:    make(chan struct{}),
-		stopExec: make(chan struct{}),
+		client:  NewClient(d, lg),
+		Workers: 1,
+		Name:    "test-queue",
+		StopC:   make(chan struct{}),
 	}
 
 	t.Run("it_should_return_error_when_max_attempts_reached", func(t *testing.T) {
@@ -257,7 +313,7 @@ func TestQueue_Requeue(t *testing.T) {
 		c.EXPECT().GetAttempts().DoAndReturn(func() int { return 1 }).Times(1)
 		c.EXPECT().GetMaxAttempts().DoAndReturn(func() int { return 5 }).Times(1)
 
-		c.EXPECT().SetID().Times(1)
+		c.EXPECT().GetID().Return("test-id").Times(1)
 
 		c.
 			EXPECT().
@@ -269,8 +325,8 @@ func TestQueue_Requeue(t *testing.T) {
 
 		d.
 			EXPECT().
-			Write("simple-queue:data:active:test-queue", []byte("test-data")).
-			DoAndReturn(func(_ string, _ []byte) error {
+			Write(gomock.Any(), "simple-queue:data:active:test-queue", []byte("test-data")).
+			DoAndReturn(func(_ context.Context, _ string, _ []byte) error {
 				return nil
 			}).
 			Times(1)
@@ -281,17 +337,85 @@ func TestQueue_Requeue(t *testing.T) {
 	})
 }
 
+func TestQueue_Requeue_backoff(t *testing.T) {
+	t.Run("it_should_hold_message_back_for_backoff_delay", func(t *testing.T) {
+		d := NewMemoryDriver()
+		queue := Queue{
+			client:  NewClient(d, &DefaultLogger{}),
+			Workers: 1,
+			Name:    "test-queue",
+			backoff: ConstantBackoff(time.Hour),
+		}
+
+		m := NewMessage(Content("test-data"))
+		m.SetMaxAttempts(1)
+
+		if err := queue.Requeue(m); err != nil {
+			t.Errorf("Expected Requeue() to requeue, got error %v", err)
+		}
+
+		if n, _ := d.Promote(context.Background(), queue.getActiveName(), time.Now().Add(time.Minute)); n != 0 {
+			t.Errorf("Expected message not to be due before backoff delay")
+		}
+
+		if n, _ := d.Promote(context.Background(), queue.getActiveName(), time.Now().Add(time.Hour)); n != 1 {
+			t.Errorf("Expected message to be due after backoff delay")
+		}
+	})
+
+	t.Run("it_should_keep_message_id", func(t *testing.T) {
+		d := NewMemoryDriver()
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		m := NewMessageWithID("order-1", Content("test-data"))
+		m.SetMaxAttempts(1)
+
+		_ = queue.Requeue(m)
+		_, _ = d.Promote(context.Background(), queue.getActiveName(), time.Now().Add(time.Hour))
+
+		if got, _ := d.Read(context.Background(), queue.getActiveName()); messageID(got) != "order-1" {
+			t.Errorf("Expected requeued message to keep ID order-1, got %s", got)
+		}
+	})
+}
+
+func TestQueue_OnExec_retry(t *testing.T) {
+	client := NewClient(NewMemoryDriver(), &DefaultLogger{})
+
+	t.Run("it_should_retry_failed_message_until_max_attempts", func(t *testing.T) {
+		q, _ := client.NewQueue("test-queue", 1, WithBackoff(ConstantBackoff(time.Millisecond)))
+		task := &failingTask{runs: make(chan struct{}, 3), failed: make(chan error, 1)}
+
+		m := NewMessage(Content("test-data"))
+		m.SetMaxAttempts(2)
+		_ = q.Push(m)
+
+		q.OnExec(task)
+
+		select {
+		case <-task.failed:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected message to finally fail")
+		}
+
+		_ = q.Stop(context.Background())
+
+		if got := len(task.runs); got != 3 {
+			t.Errorf("Expected message to run 3 times, got %v", got)
+		}
+	})
+}
+
 func TestQueue_Stop(t *testing.T) {
 	t.Run("it_should_send_a_stop_signal", func(t *testing.T) {
 		queue := Queue{
-			Workers:  1,
-			Name:     "test-queue",
-			StopC:    make(chan struct{}),
-			stopExec: make(chan struct{}),
+			Workers: 1,
+			Name:    "test-queue",
+			StopC:   make(chan struct{}),
 		}
 
 		queue.OnExec(new(TaskImpl))
-		queue.Stop()
+		_ = queue.Stop(context.Background())
 
 		expect := struct{}{}
 		got := <-queue.StopC
@@ -300,4 +424,1566 @@ func TestQueue_Stop(t *testing.T) {
 			t.Errorf("Expected StopC to receive a stop signal")
 		}
 	})
+
+	t.Run("it_should_wait_for_running_task", func(t *testing.T) {
+		client := NewClient(NewMemoryDriver(), &DefaultLogger{})
+		q, _ := client.NewQueue("test-queue", 1)
+		task := &slowTask{started: make(chan struct{}, 1), delay: 50 * time.Millisecond}
+
+		_ = q.Push(NewMessage(Content("test-data")))
+
+		q.OnExec(task)
+		<-task.started
+
+		if err := q.Stop(context.Background()); err != nil {
+			t.Errorf("Expected Stop() not to return error, got %v", err)
+		}
+
+		if stats, _ := client.GetStats(context.Background()); (*stats)["test-queue"].Processed != 1 {
+			t.Errorf("Expected running task to finish before Stop() returns")
+		}
+	})
+
+	t.Run("it_should_stop_reading_messages", func(t *testing.T) {
+		d := NewMemoryDriver()
+		q, _ := NewClient(d, &DefaultLogger{}).NewQueue("test-queue", 1)
+
+		q.OnExec(new(TaskImpl))
+		_ = q.Stop(context.Background())
+		_ = q.Push(NewMessage(Content("test-data")))
+
+		time.Sleep(150 * time.Millisecond)
+
+		if _, err := d.Read(context.Background(), q.getActiveName()); err != nil {
+			t.Errorf("Expected message not to be read once stopped, got %v", err)
+		}
+	})
+
+	t.Run("it_should_be_safe_to_call_twice", func(t *testing.T) {
+		queue := Queue{Workers: 1, Name: "test-queue"}
+
+		_ = queue.Stop(context.Background())
+
+		if err := queue.Stop(context.Background()); err != nil {
+			t.Errorf("Expected Stop() not to return error, got %v", err)
+		}
+	})
+}
+
+// slowTask takes delay to run
+type slowTask struct {
+	started chan struct{}
+	delay   time.Duration
+}
+
+func (st *slowTask) Run(c Context) error {
+	st.started <- struct{}{}
+	time.Sleep(st.delay)
+
+	return nil
+}
+
+func (st *slowTask) Fail(err error) {}
+
+func TestQueue_dedup(t *testing.T) {
+	keyed := func(id string) *Message {
+		m := NewMessageWithID(id, Content("{}"))
+		m.SetIdempotencyKey("test-key")
+
+		return m
+	}
+
+	t.Run("it_should_reject_duplicate_within_window", func(t *testing.T) {
+		d := NewMemoryDriver()
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		if err := queue.Push(keyed("a")); err != nil {
+			t.Errorf("Expected Push() not to return error, got %v", err)
+		}
+
+		if err := queue.Push(keyed("b")); !errors.Is(err, ErrDuplicateMessage) {
+			t.Errorf("Expected Push() to return error %v, got %v", ErrDuplicateMessage, err)
+		}
+
+		if got := len(d.lists[queue.getActiveName()+":active"]); got != 1 {
+			t.Errorf("Expected a single message to be pushed, got %v", got)
+		}
+	})
+
+	t.Run("it_should_push_again_once_window_passes", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithDedupWindow(time.Millisecond)(&queue)
+
+		_ = queue.Push(keyed("a"))
+		time.Sleep(5 * time.Millisecond)
+
+		if err := queue.Push(keyed("b")); err != nil {
+			t.Errorf("Expected Push() not to return error, got %v", err)
+		}
+	})
+
+	t.Run("it_should_not_reject_requeued_message", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		m := keyed("a")
+		m.SetMaxAttempts(1)
+		_ = queue.Push(m)
+
+		if err := queue.Requeue(m); err != nil {
+			t.Errorf("Expected Requeue() not to return error, got %v", err)
+		}
+	})
+
+	t.Run("it_should_report_duplicates_of_a_batch", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		results := queue.PushBatch([]Context{keyed("a"), keyed("b")})
+
+		if results[0].Err != nil || !errors.Is(results[1].Err, ErrDuplicateMessage) {
+			t.Errorf("Expected PushBatch() to report the second message as duplicate, got %v", results)
+		}
+	})
+
+	t.Run("it_should_return_error_when_driver_can_not_deduplicate", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		queue := Queue{client: NewClient(NewMockDriver(ctrl), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		if err := queue.Push(keyed("a")); err != ErrNotSupported {
+			t.Errorf("Expected Push() to return error %v, got %v", ErrNotSupported, err)
+		}
+	})
+}
+
+func TestQueue_unique(t *testing.T) {
+	job := func(id string) *Message {
+		m := NewMessageWithID(id, Content("{}"))
+		m.SetUniqueKey("test-key")
+
+		return m
+	}
+
+	t.Run("it_should_reject_unique_job_until_pending_one_completes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		task := NewMockTask(ctrl)
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		_ = queue.Push(job("a"))
+
+		if err := queue.Push(job("b")); !errors.Is(err, ErrUniqueJobLocked) {
+			t.Errorf("Expected Push() to return error %v, got %v", ErrUniqueJobLocked, err)
+		}
+
+		task.EXPECT().Run(gomock.Any()).Return(nil).Times(1)
+
+		dl, _ := queue.fetch(context.Background())
+		queue.handle(contextTask{task}, dl)
+
+		if err := queue.Push(job("b")); err != nil {
+			t.Errorf("Expected Push() not to return error once unique job completed, got %v", err)
+		}
+	})
+
+	t.Run("it_should_keep_lock_through_retries_until_job_finally_fails", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		task := NewMockTask(ctrl)
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithBackoff(ConstantBackoff(0))(&queue)
+
+		m := job("a")
+		m.SetMaxAttempts(1)
+		_ = queue.Push(m)
+
+		task.EXPECT().Run(gomock.Any()).Return(fmt.Errorf("failed to run")).Times(2)
+		task.EXPECT().Fail(gomock.Any()).Times(1)
+
+		dl, _ := queue.fetch(context.Background())
+		queue.handle(contextTask{task}, dl)
+
+		if err := queue.Push(job("b")); !errors.Is(err, ErrUniqueJobLocked) {
+			t.Errorf("Expected Push() to return error %v while job is retried, got %v", ErrUniqueJobLocked, err)
+		}
+
+		dl, _ = queue.fetch(context.Background())
+		queue.handle(contextTask{task}, dl)
+
+		if err := queue.Push(job("b")); err != nil {
+			t.Errorf("Expected Push() not to return error once unique job failed, got %v", err)
+		}
+	})
+
+	t.Run("it_should_release_lock_of_deleted_unique_job", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		_ = queue.Push(job("a"))
+
+		if err := queue.Delete("a"); err != nil {
+			t.Fatalf("Expected Delete() not to return error, got %v", err)
+		}
+
+		if err := queue.Push(job("b")); err != nil {
+			t.Errorf("Expected Push() not to return error once unique job was deleted, got %v", err)
+		}
+	})
+
+	t.Run("it_should_return_error_when_driver_can_not_lock", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		queue := Queue{client: NewClient(NewMockDriver(ctrl), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		if err := queue.Push(job("a")); err != ErrNotSupported {
+			t.Errorf("Expected Push() to return error %v, got %v", ErrNotSupported, err)
+		}
+	})
+}
+
+func TestQueue_WithIDGenerator(t *testing.T) {
+	queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+	WithIDGenerator(func() string { return "generated-id" })(&queue)
+
+	t.Run("it_should_assign_generated_id_to_message_without_one", func(t *testing.T) {
+		m := NewMessage(Content("{}"))
+		_ = queue.Push(m)
+
+		if m.GetID() != "generated-id" {
+			t.Errorf("Expected Push() to assign generated-id, got %v", m.GetID())
+		}
+	})
+
+	t.Run("it_should_keep_id_of_message", func(t *testing.T) {
+		m := NewMessageWithID("order-1", Content("{}"))
+		_ = queue.Push(m)
+
+		if m.GetID() != "order-1" {
+			t.Errorf("Expected Push() to keep order-1, got %v", m.GetID())
+		}
+	})
+}
+
+func TestQueue_PushBatch(t *testing.T) {
+	t.Run("it_should_push_every_message_with_an_id", func(t *testing.T) {
+		d := NewMemoryDriver()
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		results := queue.PushBatch([]Context{
+			NewMessageWithID("order-1", Content("a")),
+			NewMessage(Content("b")),
+		})
+
+		if len(results) != 2 || results[0].ID != "order-1" || results[1].ID == "" {
+			t.Errorf("Expected PushBatch() to return message IDs, got %v", results)
+		}
+
+		for _, id := range []string{results[0].ID, results[1].ID} {
+			if got, err := d.Read(context.Background(), queue.getActiveName()); err != nil || messageID(got) != id {
+				t.Errorf("Expected message %s to be pushed, got %s, %v", id, got, err)
+			}
+		}
+	})
+
+	t.Run("it_should_report_failed_messages", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		c := NewMockContext(ctrl)
+		d := NewMockDriver(ctrl)
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		c.EXPECT().GetID().Return("broken").Times(2)
+		c.EXPECT().Marshal().Return(nil, fmt.Errorf("failed to marshal")).Times(1)
+
+		gomock.InOrder(
+			d.EXPECT().Write(gomock.Any(), "simple-queue:data:active:test-queue", gomock.Any()).Return(fmt.Errorf("failed to write")),
+			d.EXPECT().Write(gomock.Any(), "simple-queue:data:active:test-queue", gomock.Any()).Return(nil),
+		)
+
+		results := queue.PushBatch([]Context{NewMessage(Content("a")), c, NewMessage(Content("b"))})
+
+		if results[0].Err == nil || results[1].Err == nil || results[2].Err != nil {
+			t.Errorf("Expected PushBatch() to report failures per message, got %v", results)
+		}
+
+		if results[1].ID != "broken" {
+			t.Errorf("Expected PushBatch() to return ID of failed message, got %v", results[1].ID)
+		}
+	})
+}
+
+func TestQueue_PushAt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	c := NewMockContext(ctrl)
+
+	queue := Queue{
+		Workers: 1,
+		Name:    "test-queue",
+	}
+
+	t.Run("it_should_return_error_when_driver_cannot_schedule", func(t *testing.T) {
+		queue.client = NewClient(NewMockDriver(ctrl), &DefaultLogger{})
+
+		if err := queue.PushAt(c, time.Now().Add(time.Hour)); err != ErrNotSupported {
+			t.Errorf("Expected PushAt() to return error %v, got %v", ErrNotSupported, err)
+		}
+	})
+
+	t.Run("it_should_push_when_time_is_not_in_the_future", func(t *testing.T) {
+		d := NewMockDriver(ctrl)
+		queue.client = NewClient(d, &DefaultLogger{})
+
+		c.EXPECT().GetID().Return("").Times(1)
+		c.EXPECT().SetID().Times(1)
+		c.EXPECT().Marshal().Return([]byte("test-data"), nil).Times(1)
+		d.EXPECT().Write(gomock.Any(), "simple-queue:data:active:test-queue", []byte("test-data")).Times(1)
+
+		if err := queue.PushAt(c, time.Now().Add(-time.Second)); err != nil {
+			t.Errorf("Expected PushAt() to push, got error %v", err)
+		}
+	})
+
+	t.Run("it_should_schedule_message", func(t *testing.T) {
+		d := NewMemoryDriver()
+		queue.client = NewClient(d, &DefaultLogger{})
+
+		at := time.Now().Add(time.Hour)
+
+		c.EXPECT().GetID().Return("").Times(1)
+		c.EXPECT().SetID().Times(1)
+		c.EXPECT().Marshal().Return([]byte("test-data"), nil).Times(1)
+
+		if err := queue.PushAt(c, at); err != nil {
+			t.Errorf("Expected PushAt() to schedule, got error %v", err)
+		}
+
+		if n, _ := d.Promote(context.Background(), queue.getActiveName(), at); n != 1 {
+			t.Errorf("Expected message to be scheduled until %v", at)
+		}
+	})
+}
+
+func TestQueue_PushIn(t *testing.T) {
+	client := NewClient(NewMemoryDriver(), &DefaultLogger{})
+
+	t.Run("it_should_run_message_once_delay_passes", func(t *testing.T) {
+		q, _ := client.NewQueue("test-queue", 1)
+		task := &recordingTask{done: make(chan struct{}, 1)}
+
+		pushed := time.Now()
+
+		if err := q.PushIn(NewMessage(Content("test-data")), 200*time.Millisecond); err != nil {
+			t.Errorf("Expected PushIn() to schedule, got error %v", err)
+		}
+
+		q.OnExec(task)
+
+		select {
+		case <-task.done:
+			if time.Since(pushed) < 200*time.Millisecond {
+				t.Errorf("Expected message not to run before its delay")
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Expected scheduled message to be run")
+		}
+
+		_ = q.Stop(context.Background())
+	})
+}
+
+func TestQueue_Reschedule(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	queue := Queue{
+		Workers: 1,
+		Name:    "test-queue",
+	}
+
+	t.Run("it_should_return_error_when_driver_cannot_reschedule", func(t *testing.T) {
+		queue.client = NewClient(NewMockDriver(ctrl), &DefaultLogger{})
+
+		if err := queue.Reschedule("test-id", time.Now()); err != ErrNotSupported {
+			t.Errorf("Expected Reschedule() to return error %v, got %v", ErrNotSupported, err)
+		}
+	})
+
+	t.Run("it_should_reschedule_message", func(t *testing.T) {
+		queue.client = NewClient(NewMemoryDriver(), &DefaultLogger{})
+
+		m := NewMessage(Content("test-data"))
+		_ = queue.PushIn(m, time.Hour)
+
+		if err := queue.Reschedule(m.GetID(), time.Now().Add(time.Minute)); err != nil {
+			t.Errorf("Expected Reschedule() not to return error, got %v", err)
+		}
+	})
+}
+
+func TestQueue_Delete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	queue := Queue{
+		Workers: 1,
+		Name:    "test-queue",
+	}
+
+	t.Run("it_should_return_error_when_driver_cannot_delete", func(t *testing.T) {
+		queue.client = NewClient(NewMockDriver(ctrl), &DefaultLogger{})
+
+		if err := queue.Delete("test-id"); err != ErrNotSupported {
+			t.Errorf("Expected Delete() to return error %v, got %v", ErrNotSupported, err)
+		}
+	})
+
+	t.Run("it_should_delete_message", func(t *testing.T) {
+		queue.client = NewClient(NewMemoryDriver(), &DefaultLogger{})
+
+		m := NewMessage(Content("test-data"))
+		_ = queue.Push(m)
+
+		if err := queue.Delete(m.GetID()); err != nil {
+			t.Errorf("Expected Delete() not to return error, got %v", err)
+		}
+
+		if err := queue.Delete(m.GetID()); err != ErrMessageNotFound {
+			t.Errorf("Expected Delete() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+	})
+}
+
+func TestQueue_DeadLetters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	t.Run("it_should_return_error_when_driver_cannot_store_dead_letters", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMockDriver(ctrl), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		if _, err := queue.DeadLetters(); err != ErrNotSupported {
+			t.Errorf("Expected DeadLetters() to return error %v, got %v", ErrNotSupported, err)
+		}
+	})
+
+	t.Run("it_should_keep_messages_which_failed_max_attempts", func(t *testing.T) {
+		q, _ := NewClient(NewMemoryDriver(), &DefaultLogger{}).NewQueue("test-queue", 1, WithBackoff(ConstantBackoff(time.Millisecond)))
+		task := &failingTask{runs: make(chan struct{}, 2), failed: make(chan error, 1)}
+
+		m := NewMessage(Content("test-data"))
+		m.SetMaxAttempts(1)
+		_ = q.Push(m)
+
+		q.OnExec(task)
+
+		select {
+		case <-task.failed:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected message to finally fail")
+		}
+
+		_ = q.Stop(context.Background())
+
+		letters, err := q.DeadLetters()
+
+		if err != nil || len(letters) != 1 {
+			t.Fatalf("Expected DeadLetters() to return 1 dead letter, got %v, %v", letters, err)
+		}
+
+		l := letters[0]
+
+		if l.Error != "failed to run" || string(l.Message.Content) != "test-data" || l.Message.Attempts != 1 {
+			t.Errorf("Expected dead letter to keep message and error, got %+v", l)
+		}
+
+		if len(l.Message.History) != 2 || l.FailedAt.IsZero() {
+			t.Errorf("Expected dead letter to keep attempt history, got %+v", l.Message.History)
+		}
+	})
+}
+
+func TestQueue_ReplayDeadLetter(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+	t.Run("it_should_return_error_when_dead_letter_does_not_exist", func(t *testing.T) {
+		if err := queue.ReplayDeadLetter("unknown"); err != ErrMessageNotFound {
+			t.Errorf("Expected ReplayDeadLetter() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+	})
+
+	t.Run("it_should_push_message_back_with_attempts_reset", func(t *testing.T) {
+		l := []byte(`{"message":{"id":"test-id","attempts":3,"max_attempts":3},"error":"failed"}`)
+		_ = d.AddDeadLetter(context.Background(), queue.getStatName(), "test-id", l)
+
+		if err := queue.ReplayDeadLetter("test-id"); err != nil {
+			t.Errorf("Expected ReplayDeadLetter() not to return error, got %v", err)
+		}
+
+		var m Message
+		got, _ := d.Read(context.Background(), queue.getActiveName())
+		_ = json.Unmarshal(got, &m)
+
+		if m.Attempts != 0 || m.MaxAttempts != 3 {
+			t.Errorf("Expected replayed message to have attempts reset, got %+v", m)
+		}
+
+		if _, err := queue.DeadLetter("test-id"); err != ErrMessageNotFound {
+			t.Errorf("Expected replayed dead letter to be deleted, got %v", err)
+		}
+	})
+}
+
+func TestQueue_DeleteDeadLetter(t *testing.T) {
+	d := NewMemoryDriver()
+	queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+	t.Run("it_should_delete_dead_letter", func(t *testing.T) {
+		_ = d.AddDeadLetter(context.Background(), queue.getStatName(), "test-id", []byte(`{}`))
+
+		if err := queue.DeleteDeadLetter("test-id"); err != nil {
+			t.Errorf("Expected DeleteDeadLetter() not to return error, got %v", err)
+		}
+
+		if err := queue.DeleteDeadLetter("test-id"); err != ErrMessageNotFound {
+			t.Errorf("Expected DeleteDeadLetter() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+	})
+}
+
+// blockingTask runs until the queue cancels its context
+type blockingTask struct {
+	started chan struct{}
+}
+
+func (bt *blockingTask) RunContext(ctx context.Context, c Context) error {
+	bt.started <- struct{}{}
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func (bt *blockingTask) Fail(err error) {}
+
+func TestQueue_PushContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	d := NewMockDriver(ctrl)
+
+	t.Run("it_should_return_error_when_context_is_done", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := queue.PushContext(ctx, NewMessage(Content("test-data"))); err != context.Canceled {
+			t.Errorf("Expected PushContext() to return error %v, got %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("it_should_bound_driver_calls_with_driver_timeout", func(t *testing.T) {
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithDriverTimeout(time.Second)(&queue)
+
+		d.
+			EXPECT().
+			Write(gomock.Any(), "simple-queue:data:active:test-queue", gomock.Any()).
+			DoAndReturn(func(ctx context.Context, _ string, _ []byte) error {
+				if _, ok := ctx.Deadline(); !ok {
+					t.Errorf("Expected Write() to receive a context with a deadline")
+				}
+
+				return nil
+			}).
+			Times(1)
+
+		if err := queue.Push(NewMessage(Content("test-data"))); err != nil {
+			t.Errorf("Expected Push() not to return error, got %v", err)
+		}
+	})
+}
+
+func TestQueue_OnExecContext(t *testing.T) {
+	client := NewClient(NewMemoryDriver(), &DefaultLogger{})
+
+	t.Run("it_should_cancel_running_task_and_return_message_once_stop_deadline_passes", func(t *testing.T) {
+		q, _ := client.NewQueue("test-queue", 1)
+		task := &blockingTask{started: make(chan struct{}, 1)}
+
+		_ = q.Push(NewMessage(Content("test-data")))
+
+		q.OnExecContext(task)
+
+		select {
+		case <-task.started:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected task to start")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if err := q.Stop(ctx); err != context.DeadlineExceeded {
+			t.Errorf("Expected Stop() to return error %v, got %v", context.DeadlineExceeded, err)
+		}
+
+		if _, err := q.getDriver().Read(context.Background(), q.getActiveName()); err != nil {
+			t.Errorf("Expected cancelled message to be back in queue, got %v", err)
+		}
+
+		if stats, _ := client.GetStats(context.Background()); (*stats)["test-queue"].Failed != 0 {
+			t.Errorf("Expected cancelled message not to be marked as failed")
+		}
+	})
+}
+
+// hangingTask ignores its context and runs until released
+type hangingTask struct {
+	release chan struct{}
+	failed  chan error
+}
+
+func (ht *hangingTask) RunContext(ctx context.Context, c Context) error {
+	<-ht.release
+
+	return nil
+}
+
+func (ht *hangingTask) Fail(err error) {
+	ht.failed <- err
+}
+
+func TestQueue_run_timeout(t *testing.T) {
+	task := &hangingTask{release: make(chan struct{}), failed: make(chan error, 1)}
+	t.Cleanup(func() { close(task.release) })
+
+	t.Run("it_should_fail_run_exceeding_queue_timeout", func(t *testing.T) {
+		queue := Queue{Name: "test-queue"}
+		WithTaskTimeout(10 * time.Millisecond)(&queue)
+
+		if _, err := queue.run(context.Background(), task, NewMessage(Content("test-data"))); !errors.Is(err, ErrTaskTimeout) {
+			t.Errorf("Expected run() to return error %v, got %v", ErrTaskTimeout, err)
+		}
+	})
+
+	t.Run("it_should_prefer_message_timeout", func(t *testing.T) {
+		queue := Queue{Name: "test-queue", taskTimeout: time.Hour}
+
+		m := NewMessage(Content("test-data"))
+		m.SetTimeout(10 * time.Millisecond)
+
+		if _, err := queue.run(context.Background(), task, m); !errors.Is(err, ErrTaskTimeout) {
+			t.Errorf("Expected run() to return error %v, got %v", ErrTaskTimeout, err)
+		}
+	})
+
+	t.Run("it_should_return_task_result_within_timeout", func(t *testing.T) {
+		queue := Queue{Name: "test-queue", taskTimeout: time.Hour}
+
+		if _, err := queue.run(context.Background(), contextTask{&failingTask{runs: make(chan struct{}, 1)}}, NewMessage(nil)); err == nil || errors.Is(err, ErrTaskTimeout) {
+			t.Errorf("Expected run() to return task error, got %v", err)
+		}
+	})
+
+	t.Run("it_should_fail_timed_out_message_through_retry_handling", func(t *testing.T) {
+		client := NewClient(NewMemoryDriver(), &DefaultLogger{})
+		q, _ := client.NewQueue("test-queue", 1, WithTaskTimeout(10*time.Millisecond))
+
+		_ = q.Push(NewMessage(Content("test-data")))
+
+		q.OnExecContext(task)
+
+		select {
+		case err := <-task.failed:
+			if !errors.Is(err, ErrTaskTimeout) {
+				t.Errorf("Expected Fail() to receive error %v, got %v", ErrTaskTimeout, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected timed out message to fail")
+		}
+
+		_ = q.Stop(context.Background())
+	})
+}
+
+func TestQueue_handle_panic(t *testing.T) {
+	t.Run("it_should_fail_panicking_task_and_keep_worker_alive", func(t *testing.T) {
+		d := NewMemoryDriver()
+		q, _ := NewClient(d, &DefaultLogger{}).NewQueue("test-queue", 1)
+		task := &panickingTask{failed: make(chan error, 2)}
+
+		_ = q.Push(NewMessage(Content("a")))
+		_ = q.Push(NewMessage(Content("b")))
+
+		q.OnExec(task)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case err := <-task.failed:
+				var pe *PanicError
+
+				if !errors.As(err, &pe) {
+					t.Errorf("Expected Fail() to receive PanicError, got %v", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("Expected both panicking messages to fail")
+			}
+		}
+
+		_ = q.Stop(context.Background())
+
+		if stats, _ := d.GetStats(context.Background()); (*stats)["test-queue"].Failed != 2 {
+			t.Errorf("Expected both panicking messages to be marked as failed")
+		}
+	})
+
+	t.Run("it_should_recover_panicking_fail", func(t *testing.T) {
+		d := NewMemoryDriver()
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		_ = d.Register(context.Background(), "test-queue")
+		_ = queue.Push(NewMessage(Content("a")))
+		m, _ := d.Read(context.Background(), queue.getActiveName())
+
+		queue.handle(contextTask{&panickingFailTask{}}, delivery{queue: queue.getActiveName(), d: m})
+
+		if stats, _ := d.GetStats(context.Background()); (*stats)["test-queue"].Failed != 1 {
+			t.Errorf("Expected message to be marked as failed")
+		}
+	})
+
+	t.Run("it_should_return_message_and_panic_again_with_repanic", func(t *testing.T) {
+		d := NewMemoryDriver()
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithRepanic()(&queue)
+
+		_ = queue.Push(NewMessage(Content("a")))
+		m, _ := d.Read(context.Background(), queue.getActiveName())
+
+		defer func() {
+			if v := recover(); v == nil {
+				t.Errorf("Expected handle() to panic")
+			}
+
+			if _, err := d.Read(context.Background(), queue.getActiveName()); err != nil {
+				t.Errorf("Expected message to be back in queue, got %v", err)
+			}
+		}()
+
+		queue.handle(contextTask{&panickingTask{failed: make(chan error, 1)}}, delivery{queue: queue.getActiveName(), d: m})
+	})
+}
+
+// pollingDriver is a memory driver refusing to block
+type pollingDriver struct {
+	*MemoryDriver
+}
+
+func (pd pollingDriver) ReadBlocking(ctx context.Context, queue string, timeout time.Duration) ([]byte, error) {
+	return nil, ErrNotSupported
+}
+
+func TestQueue_fetch(t *testing.T) {
+	t.Run("it_should_log_error_when_it_fails_to_read_data", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		d := NewMockDriver(ctrl)
+		dl := NewMockLogger(ctrl)
+		queue := Queue{client: NewClient(d, dl), Workers: 1, Name: "test-queue"}
+
+		gomock.InOrder(
+			d.EXPECT().Read(gomock.Any(), "simple-queue:data:active:test-queue").Return(nil, fmt.Errorf("failed to read")),
+			d.EXPECT().Read(gomock.Any(), "simple-queue:data:active:test-queue").Return([]byte("{}"), nil),
+		)
+
+		dl.EXPECT().Warn(fmt.Errorf("failed to read")).Times(1)
+
+		if got, ok := queue.fetch(context.Background()); !ok || string(got.d) != "{}" {
+			t.Errorf("Expected fetch() to return {}, got %s", got.d)
+		}
+	})
+
+	t.Run("it_should_poll_when_driver_can_not_block", func(t *testing.T) {
+		d := pollingDriver{NewMemoryDriver()}
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			_ = queue.Push(NewMessage(Content("test-data")))
+		}()
+
+		if _, ok := queue.fetch(context.Background()); !ok {
+			t.Errorf("Expected fetch() to return pushed message")
+		}
+	})
+
+	t.Run("it_should_return_once_context_is_done", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		if _, ok := queue.fetch(ctx); ok {
+			t.Errorf("Expected fetch() to return false once context is done")
+		}
+	})
+}
+
+func TestQueue_priorities(t *testing.T) {
+	t.Run("it_should_read_higher_priorities_first", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithPriorities(5, -1)(&queue)
+
+		for _, p := range []int{0, -1, 5} {
+			m := NewMessageWithID(fmt.Sprint(p), Content("{}"))
+			m.SetPriority(p)
+
+			if err := queue.Push(m); err != nil {
+				t.Errorf("Expected Push() not to return error, got %v", err)
+			}
+		}
+
+		for _, p := range []int{5, 0, -1} {
+			if got, ok := queue.fetch(context.Background()); !ok || got.queue != queue.priorityName(p) || messageID(got.d) != fmt.Sprint(p) {
+				t.Errorf("Expected fetch() to return priority %v message, got %s from %v", p, got.d, got.queue)
+			}
+		}
+	})
+
+	t.Run("it_should_return_error_when_priority_is_not_read", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		m := NewMessage(Content("{}"))
+		m.SetPriority(5)
+
+		if err := queue.Push(m); !errors.Is(err, ErrUnknownPriority) {
+			t.Errorf("Expected Push() to return error %v, got %v", ErrUnknownPriority, err)
+		}
+	})
+
+	t.Run("it_should_read_lower_priorities_once_starvation_limit_is_reached", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithPriorities(5)(&queue)
+		WithStarvationLimit(2)(&queue)
+
+		for _, p := range []int{5, 5, 5, 0} {
+			m := NewMessage(Content("{}"))
+			m.SetPriority(p)
+			_ = queue.Push(m)
+		}
+
+		for _, p := range []int{5, 5, 0, 5} {
+			if got, _ := queue.fetch(context.Background()); got.queue != queue.priorityName(p) {
+				t.Errorf("Expected fetch() to read from %v, got %v", queue.priorityName(p), got.queue)
+			}
+		}
+	})
+
+	t.Run("it_should_read_levels_one_by_one_when_driver_is_not_a_priority_reader", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		d := NewMockDriver(ctrl)
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithPriorities(5)(&queue)
+
+		gomock.InOrder(
+			d.EXPECT().Read(gomock.Any(), "simple-queue:data:active:test-queue:priority:5").Return(nil, redis.Nil),
+			d.EXPECT().Read(gomock.Any(), "simple-queue:data:active:test-queue").Return([]byte("{}"), nil),
+		)
+
+		if got, ok := queue.fetch(context.Background()); !ok || got.queue != queue.getActiveName() {
+			t.Errorf("Expected fetch() to read from %v, got %v", queue.getActiveName(), got.queue)
+		}
+	})
+}
+
+func TestQueue_expire(t *testing.T) {
+	t.Run("it_should_skip_expired_messages_without_counting_them_when_not_supported", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		d := NewMemoryDriver()
+		task := NewMockTask(ctrl)
+		// hides every optional capability of the memory driver
+		queue := Queue{client: NewClient(struct{ Driver }{d}, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		_ = d.Register(context.Background(), "test-queue")
+
+		m := NewMessage(Content("{}"))
+		m.SetExpiresAt(time.Now().Add(-time.Second))
+		_ = queue.Push(m)
+
+		task.EXPECT().Run(gomock.Any()).Times(0)
+
+		dl, _ := queue.fetch(context.Background())
+		queue.handle(contextTask{task}, dl)
+
+		if stats, _ := d.GetStats(context.Background()); (*stats)["test-queue"].Expired != 0 {
+			t.Errorf("Expected expired message not to be counted")
+		}
+	})
+
+	t.Run("it_should_skip_expired_messages", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		d := NewMemoryDriver()
+		task := NewMockTask(ctrl)
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		_ = d.Register(context.Background(), "test-queue")
+
+		var expired []string
+
+		WithExpiredHandler(func(c Context) {
+			expired = append(expired, c.GetID())
+		})(&queue)
+		WithExpiredDeadLetters()(&queue)
+
+		m := NewMessageWithID("test-id", Content("{}"))
+		m.SetExpiresAt(time.Now().Add(-time.Second))
+		_ = queue.Push(m)
+
+		task.EXPECT().Run(gomock.Any()).Times(0)
+
+		dl, _ := queue.fetch(context.Background())
+		queue.handle(contextTask{task}, dl)
+
+		if !reflect.DeepEqual(expired, []string{"test-id"}) {
+			t.Errorf("Expected expired handler to be called with test-id, got %v", expired)
+		}
+
+		if l, err := queue.DeadLetter("test-id"); err != nil || l.Error != ErrMessageExpired.Error() {
+			t.Errorf("Expected expired message to be dead lettered, got %v, %v", l, err)
+		}
+
+		if stats, _ := d.GetStats(context.Background()); (*stats)["test-queue"].Expired != 1 {
+			t.Errorf("Expected 1 expired message, got %v", (*stats)["test-queue"].Expired)
+		}
+
+		if got := len(d.lists[queue.getActiveName()+":in-flight"]); got != 0 {
+			t.Errorf("Expected expired message to be acked, got %v in-flight messages", got)
+		}
+	})
+
+	t.Run("it_should_leave_expired_messages_out_of_batches", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		task := &recordingBatchTask{}
+
+		m := NewMessageWithID("expired", Content("{}"))
+		m.SetExpiresAt(time.Now().Add(-time.Second))
+		expired, _ := m.Marshal()
+
+		queue.handleBatch(task, []delivery{
+			{queue: queue.getActiveName(), d: expired},
+			{queue: queue.getActiveName(), d: []byte(`{"id":"a"}`)},
+		})
+
+		if !reflect.DeepEqual(task.sizes, []int{1}) {
+			t.Errorf("Expected RunBatch() to receive a single message, got batches of %v", task.sizes)
+		}
+	})
+}
+
+func TestQueue_throttle(t *testing.T) {
+	queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+	WithRateLimit(20, 1)(&queue)
+
+	t.Run("it_should_wait_for_a_token", func(t *testing.T) {
+		start := time.Now()
+
+		for i := 0; i < 2; i++ {
+			if !queue.throttle(context.Background()) {
+				t.Errorf("Expected throttle() to take a token")
+			}
+		}
+
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Errorf("Expected second token to take about 50ms, got %v", elapsed)
+		}
+	})
+
+	t.Run("it_should_return_once_context_is_done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if queue.throttle(ctx) {
+			t.Errorf("Expected throttle() to return false once context is done")
+		}
+	})
+}
+
+// concurrentTask records how many runs overlap at most
+type concurrentTask struct {
+	mu      sync.Mutex
+	running int
+	max     int
+	done    chan struct{}
+}
+
+func (ct *concurrentTask) Run(c Context) error {
+	ct.mu.Lock()
+	ct.running++
+
+	if ct.running > ct.max {
+		ct.max = ct.running
+	}
+
+	ct.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	ct.mu.Lock()
+	ct.running--
+	ct.mu.Unlock()
+
+	ct.done <- struct{}{}
+
+	return nil
+}
+
+// groupTask records the runs of each group, it fails the first run of message fail
+type groupTask struct {
+	concurrentTask
+	runs     map[string][]string
+	active   map[string]bool
+	fail     string
+	failed   bool
+	overlaps int
+}
+
+func (gt *groupTask) Run(c Context) error {
+	var v string
+	_ = json.Unmarshal(c.GetContent(), &v)
+	g := groupKeyOf(c)
+
+	gt.mu.Lock()
+
+	if gt.active == nil {
+		gt.active = map[string]bool{}
+	}
+
+	if gt.active[g] {
+		gt.overlaps++
+	}
+
+	gt.active[g] = true
+	gt.runs[g] = append(gt.runs[g], v)
+	fail := v == gt.fail && !gt.failed
+	gt.failed = gt.failed || fail
+
+	gt.mu.Unlock()
+
+	if fail {
+		gt.mu.Lock()
+		gt.active[g] = false
+		gt.mu.Unlock()
+
+		return errors.New("failed")
+	}
+
+	err := gt.concurrentTask.Run(c)
+
+	gt.mu.Lock()
+	gt.active[g] = false
+	gt.mu.Unlock()
+
+	return err
+}
+
+func (ct *concurrentTask) Fail(err error) {}
+
+func TestQueue_acquire(t *testing.T) {
+	t.Run("it_should_wait_for_a_free_slot", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithConcurrencyLimit(1, time.Minute)(&queue)
+
+		release, ok := queue.acquire(context.Background())
+
+		if !ok {
+			t.Fatalf("Expected acquire() to take a slot")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+
+		if _, ok := queue.acquire(ctx); ok {
+			t.Errorf("Expected acquire() to wait while no slot is free")
+		}
+
+		release()
+
+		if _, ok := queue.acquire(context.Background()); !ok {
+			t.Errorf("Expected acquire() to take released slot")
+		}
+	})
+
+	t.Run("it_should_renew_lease_while_slot_is_held", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithConcurrencyLimit(1, 30*time.Millisecond)(&queue)
+
+		release, _ := queue.acquire(context.Background())
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		if _, ok := queue.acquire(ctx); ok {
+			t.Errorf("Expected lease of held slot to be renewed")
+		}
+	})
+
+	t.Run("it_should_keep_slot_of_abandoned_task_until_it_returns", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithConcurrencyLimit(1, 30*time.Millisecond)(&queue)
+		WithTaskTimeout(10 * time.Millisecond)(&queue)
+		task := &hangingTask{release: make(chan struct{}), failed: make(chan error, 1)}
+
+		_ = queue.Push(NewMessage(Content("{}")))
+		dl, _ := queue.fetch(context.Background())
+		queue.handle(task, dl)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		if _, ok := queue.acquire(ctx); ok {
+			t.Errorf("Expected abandoned task to keep its slot")
+		}
+
+		close(task.release)
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if release, ok := queue.acquire(ctx); !ok {
+			t.Errorf("Expected slot to be released once abandoned task returned")
+		} else {
+			release()
+		}
+	})
+
+	t.Run("it_should_limit_runs_across_queues", func(t *testing.T) {
+		client := NewClient(NewMemoryDriver(), &DefaultLogger{})
+		task := &concurrentTask{done: make(chan struct{}, 10)}
+		var queues []*Queue
+
+		// two processes consuming the same queue
+		for i := 0; i < 2; i++ {
+			q, _ := client.NewQueue("test-queue", 4, WithConcurrencyLimit(2, time.Minute))
+			queues = append(queues, q)
+		}
+
+		for i := 0; i < 10; i++ {
+			_ = queues[0].Push(NewMessage(Content("{}")))
+		}
+
+		for _, q := range queues {
+			q.OnExec(task)
+		}
+
+		for i := 0; i < 10; i++ {
+			select {
+			case <-task.done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Expected pushed messages to be run")
+			}
+		}
+
+		for _, q := range queues {
+			_ = q.Stop(context.Background())
+		}
+
+		if task.max > 2 {
+			t.Errorf("Expected at most 2 concurrent runs, got %v", task.max)
+		}
+	})
+}
+
+func TestQueue_fairDispatch(t *testing.T) {
+	t.Run("it_should_reject_tenant_messages_unless_fair_dispatch_is_enabled", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		m := NewMessage(Content("{}"))
+		m.SetTenantKey("customer-1")
+
+		if err := queue.Push(m); !errors.Is(err, ErrFairDispatchDisabled) {
+			t.Errorf("Expected Push() to return error %v, got %v", ErrFairDispatchDisabled, err)
+		}
+	})
+
+	t.Run("it_should_reject_scheduled_tenant_messages_unless_fair_dispatch_is_enabled", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		m := NewMessage(Content("{}"))
+		m.SetTenantKey("customer-1")
+
+		if err := queue.PushIn(m, time.Minute); !errors.Is(err, ErrFairDispatchDisabled) {
+			t.Errorf("Expected PushIn() to return error %v, got %v", ErrFairDispatchDisabled, err)
+		}
+	})
+
+	t.Run("it_should_take_turns_between_tenants", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithFairDispatch(nil)(&queue)
+
+		for _, tenant := range []string{"noisy", "noisy", "noisy", "quiet", ""} {
+			m := NewMessage(Content("{}"))
+			m.SetTenantKey(tenant)
+
+			if err := queue.Push(m); err != nil {
+				t.Errorf("Expected Push() not to return error, got %v", err)
+			}
+		}
+
+		var got []string
+
+		for i := 0; i < 5; i++ {
+			dl, ok := queue.fetch(context.Background())
+
+			if !ok {
+				t.Fatalf("Expected fetch() to return a message")
+			}
+
+			got = append(got, dl.tenant)
+		}
+
+		if expect := []string{"noisy", "", "quiet", "noisy", "noisy"}; !reflect.DeepEqual(got, expect) {
+			t.Errorf("Expected fetch() to read tenants %v, got %v", expect, got)
+		}
+	})
+
+	t.Run("it_should_return_nacked_message_to_its_tenant", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithFairDispatch(map[string]int{"a": 2})(&queue)
+
+		m := NewMessage(Content("{}"))
+		m.SetTenantKey("a")
+		_ = queue.Push(m)
+
+		dl, _ := queue.fetch(context.Background())
+		queue.nack(dl)
+
+		if got, ok := queue.fetch(context.Background()); !ok || got.tenant != "a" || messageID(got.d) != m.GetID() {
+			t.Errorf("Expected fetch() to return nacked message of tenant a, got %s", got.d)
+		}
+	})
+}
+
+func TestQueue_groups(t *testing.T) {
+	t.Run("it_should_reject_grouped_messages_unless_groups_are_enabled", func(t *testing.T) {
+		client := NewClient(NewMemoryDriver(), &DefaultLogger{})
+		q, _ := client.NewQueue("test-queue", 1)
+		m := NewMessage(Content("{}"))
+		m.SetGroupKey("customer-1")
+
+		if err := q.Push(m); !errors.Is(err, ErrGroupsDisabled) {
+			t.Errorf("Expected Push() to return ErrGroupsDisabled, got %v", err)
+		}
+	})
+
+	t.Run("it_should_run_messages_of_a_group_in_order_one_at_a_time", func(t *testing.T) {
+		client := NewClient(NewMemoryDriver(), &DefaultLogger{})
+		q, _ := client.NewQueue("test-queue", 4, WithGroups(time.Minute), WithBackoff(ConstantBackoff(time.Millisecond)))
+		task := &groupTask{concurrentTask: concurrentTask{done: make(chan struct{}, 10)}, runs: map[string][]string{}, fail: "a:2"}
+
+		for i := 0; i < 5; i++ {
+			for _, g := range []string{"a", "b"} {
+				m := NewMessage(Content(fmt.Sprintf(`"%s:%d"`, g, i)))
+				m.SetGroupKey(g)
+				m.SetMaxAttempts(2)
+				_ = q.Push(m)
+			}
+		}
+
+		q.OnExec(task)
+
+		for i := 0; i < 10; i++ {
+			select {
+			case <-task.done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Expected pushed messages to be run")
+			}
+		}
+
+		_ = q.Stop(context.Background())
+
+		expect := map[string][]string{
+			"a": {"a:0", "a:1", "a:2", "a:2", "a:3", "a:4"},
+			"b": {"b:0", "b:1", "b:2", "b:3", "b:4"},
+		}
+
+		if !reflect.DeepEqual(task.runs, expect) {
+			t.Errorf("Expected groups to run in order with retries first, got %v", task.runs)
+		}
+
+		if task.overlaps > 0 {
+			t.Errorf("Expected messages of a group to never run concurrently, got %v overlaps", task.overlaps)
+		}
+
+		if task.max < 2 {
+			t.Errorf("Expected groups to run concurrently, got %v", task.max)
+		}
+	})
+
+	t.Run("it_should_keep_group_locked_until_abandoned_task_returns", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithGroups(30 * time.Millisecond)(&queue)
+		WithTaskTimeout(10 * time.Millisecond)(&queue)
+		task := &hangingTask{release: make(chan struct{}), failed: make(chan error, 1)}
+
+		var ids []string
+
+		for i := 0; i < 2; i++ {
+			m := NewMessage(Content("{}"))
+			m.SetGroupKey("a")
+			_ = queue.Push(m)
+			ids = append(ids, m.GetID())
+		}
+
+		dl, _ := queue.fetch(context.Background())
+		queue.handle(task, dl)
+		time.Sleep(100 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if got, ok := queue.fetch(ctx); ok {
+			t.Errorf("Expected group to stay locked while abandoned task runs, got %s", got.d)
+		}
+
+		close(task.release)
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if got, ok := queue.fetch(ctx); !ok || messageID(got.d) != ids[1] {
+			t.Errorf("Expected fetch() to return next message of group once abandoned task returned, got %s", got.d)
+		}
+	})
+
+	t.Run("it_should_keep_group_locked_while_waiting_for_a_slot", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithGroups(30 * time.Millisecond)(&queue)
+		WithConcurrencyLimit(1, time.Minute)(&queue)
+		task := &hangingTask{release: make(chan struct{}), failed: make(chan error, 1)}
+		close(task.release)
+
+		m := NewMessage(Content("{}"))
+		m.SetGroupKey("a")
+		_ = queue.Push(m)
+
+		dl, _ := queue.fetch(context.Background())
+		// the only slot is held elsewhere
+		release, _ := queue.acquire(context.Background())
+		handled := make(chan struct{})
+
+		go func() {
+			queue.handle(task, dl)
+			close(handled)
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if got, ok := queue.fetch(ctx); ok {
+			t.Errorf("Expected group to stay locked while its message waits for a slot, got %s", got.d)
+		}
+
+		release()
+
+		select {
+		case <-handled:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected message to be handled once the slot was released")
+		}
+	})
+
+	t.Run("it_should_delete_but_not_reschedule_pending_grouped_message", func(t *testing.T) {
+		queue := Queue{client: NewClient(NewMemoryDriver(), &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithGroups(time.Minute)(&queue)
+
+		m := NewMessage(Content("{}"))
+		m.SetGroupKey("a")
+		_ = queue.Push(m)
+
+		if err := queue.Reschedule(m.GetID(), time.Now()); !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Expected Reschedule() to return error %v, got %v", ErrNotSupported, err)
+		}
+
+		if err := queue.Delete(m.GetID()); err != nil {
+			t.Errorf("Expected Delete() not to return error, got %v", err)
+		}
+	})
+
+	t.Run("it_should_not_requeue_grouped_message", func(t *testing.T) {
+		d := NewMemoryDriver()
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		WithGroups(time.Minute)(&queue)
+
+		m := NewMessage(Content("{}"))
+		m.SetGroupKey("a")
+		m.SetMaxAttempts(3)
+		_ = queue.Push(m)
+
+		dl, _ := queue.fetch(context.Background())
+
+		if err := queue.Requeue(m); !errors.Is(err, ErrGroupedMessage) {
+			t.Errorf("Expected Requeue() to return error %v, got %v", ErrGroupedMessage, err)
+		}
+
+		queue.ack(dl)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if got, ok := queue.fetch(ctx); ok {
+			t.Errorf("Expected Requeue() not to push a copy of grouped message, got %s", got.d)
+		}
+	})
+}
+
+func TestQueue_nextPoll(t *testing.T) {
+	queue := Queue{Name: "test-queue"}
+	WithPollInterval(10*time.Millisecond, 30*time.Millisecond)(&queue)
+
+	t.Run("it_should_double_pause_up_to_max", func(t *testing.T) {
+		var got []time.Duration
+		var idle time.Duration
+
+		for i := 0; i < 4; i++ {
+			idle = queue.nextPoll(idle)
+			got = append(got, idle)
+		}
+
+		expect := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond}
+
+		if !reflect.DeepEqual(expect, got) {
+			t.Errorf("Expected nextPoll() to return %v, got %v", expect, got)
+		}
+	})
+}
+
+// countingTask counts down every run
+type countingTask struct {
+	wg *sync.WaitGroup
+}
+
+func (ct countingTask) Run(c Context) error {
+	ct.wg.Done()
+
+	return nil
+}
+
+func (ct countingTask) Fail(err error) {}
+
+func benchmarkOnExec(b *testing.B, d Driver) {
+	q, _ := NewClient(d, &DefaultLogger{}).NewQueue("bench-queue", 8)
+	var wg sync.WaitGroup
+
+	wg.Add(b.N)
+
+	for i := 0; i < b.N; i++ {
+		_ = q.Push(NewMessage(Content("test-data")))
+	}
+
+	b.ResetTimer()
+	q.OnExec(countingTask{&wg})
+	wg.Wait()
+	b.StopTimer()
+
+	_ = q.Stop(context.Background())
+}
+
+func BenchmarkQueue_OnExec_blocking(b *testing.B) {
+	benchmarkOnExec(b, NewMemoryDriver())
+}
+
+func BenchmarkQueue_OnExec_polling(b *testing.B) {
+	benchmarkOnExec(b, pollingDriver{NewMemoryDriver()})
+}
+
+// recordingBatchTask fails messages with bad content and records batch sizes
+type recordingBatchTask struct {
+	mu     sync.Mutex
+	sizes  []int
+	failed chan error
+}
+
+func (rb *recordingBatchTask) RunBatch(ctx context.Context, cs []Context) []error {
+	rb.mu.Lock()
+	rb.sizes = append(rb.sizes, len(cs))
+	rb.mu.Unlock()
+
+	errs := make([]error, len(cs))
+
+	for i, c := range cs {
+		if string(c.GetContent()) == "bad" {
+			errs[i] = fmt.Errorf("bad message")
+		}
+	}
+
+	return errs
+}
+
+func (rb *recordingBatchTask) Fail(err error) {
+	rb.failed <- err
+}
+
+func TestQueue_OnExecBatch(t *testing.T) {
+	t.Run("it_should_run_batches_and_fail_only_failed_messages", func(t *testing.T) {
+		d := NewMemoryDriver()
+		q, _ := NewClient(d, &DefaultLogger{}).NewQueue("test-queue", 1)
+		task := &recordingBatchTask{failed: make(chan error, 1)}
+
+		for _, c := range []string{"a", "bad", "b", "c", "d"} {
+			_ = q.Push(NewMessage(Content(c)))
+		}
+
+		q.OnExecBatch(task, 3, 50*time.Millisecond)
+
+		select {
+		case err := <-task.failed:
+			if err.Error() != "bad message" {
+				t.Errorf("Expected Fail() to receive bad message error, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected bad message to fail")
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		_ = q.Stop(context.Background())
+
+		task.mu.Lock()
+		defer task.mu.Unlock()
+
+		if !reflect.DeepEqual(task.sizes, []int{3, 2}) {
+			t.Errorf("Expected batches of 3 and 2 messages, got %v", task.sizes)
+		}
+
+		if stats, _ := d.GetStats(context.Background()); (*stats)["test-queue"].Processed != 4 || (*stats)["test-queue"].Failed != 1 {
+			t.Errorf("Expected 4 processed and 1 failed message, got %+v", (*stats)["test-queue"])
+		}
+	})
+}
+
+// panickingBatchTask panics on every batch
+type panickingBatchTask struct {
+	failed chan error
+}
+
+func (pb *panickingBatchTask) RunBatch(ctx context.Context, cs []Context) []error {
+	panic("boom")
+}
+
+func (pb *panickingBatchTask) Fail(err error) {
+	pb.failed <- err
+}
+
+func TestQueue_handleBatch(t *testing.T) {
+	t.Run("it_should_fail_every_message_when_task_panics", func(t *testing.T) {
+		d := NewMemoryDriver()
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		task := &panickingBatchTask{failed: make(chan error, 2)}
+
+		queue.handleBatch(task, []delivery{
+			{queue: queue.getActiveName(), d: []byte(`{"id":"a"}`)},
+			{queue: queue.getActiveName(), d: []byte(`{"id":"b"}`)},
+		})
+
+		var pe *PanicError
+
+		for i := 0; i < 2; i++ {
+			if err := <-task.failed; !errors.As(err, &pe) {
+				t.Errorf("Expected Fail() to receive PanicError, got %v", err)
+			}
+		}
+	})
+
+	t.Run("it_should_drop_malformed_messages", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		d := NewMockDriver(ctrl)
+		queue := Queue{client: NewClient(d, &DefaultLogger{}), Workers: 1, Name: "test-queue"}
+		task := NewMockBatchTask(ctrl)
+
+		d.EXPECT().Ack(gomock.Any(), "simple-queue:data:active:test-queue", []byte("{")).Times(1)
+		task.EXPECT().RunBatch(gomock.Any(), gomock.Any()).Times(0)
+
+		queue.handleBatch(task, []delivery{{queue: queue.getActiveName(), d: []byte("{")}})
+	})
 }
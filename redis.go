@@ -1,61 +1,1435 @@
 package simpleq
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
+// RedisMode selects how RedisQueueDriver stores pending messages
+type RedisMode int
+
+const (
+	// RedisModeSet stores pending messages in a set, they are read in random order
+	// and byte-identical messages are stored only once
+	RedisModeSet RedisMode = iota
+	// RedisModeList stores pending messages in a list, they are read first in first out
+	// and never deduplicated unless WithRedisDedup is given
+	RedisModeList
+)
+
+var (
+	// moves a single message from the active set into the consumer's in-flight list
+	redisReadScript = redis.NewScript(`
+local m = redis.call('SPOP', KEYS[1])
+if m then
+	redis.call('LPUSH', KEYS[2], m)
+end
+return m
+`)
+
+	// removes a message from the in-flight list and puts it back into the active set
+	redisNackScript = redis.NewScript(`
+if redis.call('LREM', KEYS[2], 1, ARGV[1]) > 0 then
+	redis.call('SADD', KEYS[1], ARGV[1])
+	return 1
+end
+return 0
+`)
+
+	// moves every message of an in-flight list back into the active set, messages of tenants are moved
+	// back to the head of their tenant instead. Tenant keys are derived from the ARGV[1] prefix
+	redisRecoverScript = redis.NewScript(`
+local n = 0
+local m = redis.call('LPOP', KEYS[2])
+while m do
+	local ok, v = pcall(cjson.decode, m)
+	local t = ok and type(v) == 'table' and v['tenant_key']
+	if type(t) == 'string' and t ~= '' then
+		redis.call('RPUSH', ARGV[1] .. t, m)
+		if redis.call('HINCRBY', KEYS[3], t, 1) == 1 then
+			redis.call('RPUSH', KEYS[4], t)
+		end
+	else
+		redis.call('SADD', KEYS[1], m)
+	end
+	n = n + 1
+	m = redis.call('LPOP', KEYS[2])
+end
+return n
+`)
+
+	// adds a message to the active set or pushes it into the active list unless an identical one is already
+	// pending in dedup mode, then indexes it by its id ARGV[2]
+	redisWriteScript = redis.NewScript(`
+if ARGV[3] ~= '1' then
+	redis.call('SADD', KEYS[1], ARGV[1])
+elseif ARGV[4] == '1' and redis.call('SADD', KEYS[3], ARGV[1]) == 0 then
+	return 0
+else
+	redis.call('LPUSH', KEYS[2], ARGV[1])
+end
+if ARGV[2] ~= '' then
+	redis.call('HSET', KEYS[4], ARGV[2], ARGV[1])
+end
+return 1
+`)
+
+	// removes a message from the in-flight list, its index entry is removed unless a retry replaced it
+	redisAckScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+if ARGV[2] ~= '' and redis.call('HGET', KEYS[2], ARGV[2]) == ARGV[1] then
+	redis.call('HDEL', KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+	// moves the oldest message of the active list into the consumer's in-flight list,
+	// falls back to the set layout so messages written before switching modes are not lost
+	redisListReadScript = redis.NewScript(`
+local m = redis.call('RPOPLPUSH', KEYS[1], KEYS[3])
+if not m then
+	m = redis.call('SPOP', KEYS[2])
+	if m then
+		redis.call('LPUSH', KEYS[3], m)
+	end
+end
+if m then
+	redis.call('SREM', KEYS[4], m)
+end
+return m
+`)
+
+	// reads from the first non empty of many queues, KEYS hold the active list, active set,
+	// in-flight list and members set of every queue in read order
+	redisReadFirstScript = redis.NewScript(`
+for i = 1, #KEYS, 4 do
+	local m
+	if ARGV[1] == '1' then
+		m = redis.call('RPOPLPUSH', KEYS[i], KEYS[i + 2])
+	end
+	if not m then
+		m = redis.call('SPOP', KEYS[i + 1])
+		if m then
+			redis.call('LPUSH', KEYS[i + 2], m)
+		end
+	end
+	if m then
+		if ARGV[1] == '1' then
+			redis.call('SREM', KEYS[i + 3], m)
+		end
+		return {(i - 1) / 4, m}
+	end
+end
+return false
+`)
+
+	// removes a message from the in-flight list and puts it back at the head of the active list
+	redisListNackScript = redis.NewScript(`
+if redis.call('LREM', KEYS[2], 1, ARGV[1]) > 0 then
+	redis.call('RPUSH', KEYS[1], ARGV[1])
+	if ARGV[2] == '1' then
+		redis.call('SADD', KEYS[3], ARGV[1])
+	end
+	return 1
+end
+return 0
+`)
+
+	// moves every message of an in-flight list back to the head of the active list keeping their order,
+	// messages of tenants are moved back to the head of their tenant instead
+	redisListRecoverScript = redis.NewScript(`
+local n = 0
+local m = redis.call('LPOP', KEYS[2])
+while m do
+	local ok, v = pcall(cjson.decode, m)
+	local t = ok and type(v) == 'table' and v['tenant_key']
+	if type(t) == 'string' and t ~= '' then
+		redis.call('RPUSH', ARGV[1] .. t, m)
+		if redis.call('HINCRBY', KEYS[3], t, 1) == 1 then
+			redis.call('RPUSH', KEYS[4], t)
+		end
+	else
+		redis.call('RPUSH', KEYS[1], m)
+	end
+	n = n + 1
+	m = redis.call('LPOP', KEYS[2])
+end
+return n
+`)
+
+	// moves due scheduled messages into the active set or list, messages of tenants are moved back to the
+	// tail of their tenant instead. Tenant keys are derived from the ARGV[4] prefix
+	redisPromoteScript = redis.NewScript(`
+local ms = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 1000)
+for _, m in ipairs(ms) do
+	redis.call('ZREM', KEYS[1], m)
+	local ok, v = pcall(cjson.decode, m)
+	local t = ok and type(v) == 'table' and v['tenant_key']
+	if type(t) == 'string' and t ~= '' then
+		redis.call('LPUSH', ARGV[4] .. t, m)
+		if redis.call('HINCRBY', KEYS[5], t, 1) == 1 then
+			redis.call('LPUSH', KEYS[6], t)
+		end
+	elseif ARGV[2] ~= '1' then
+		redis.call('SADD', KEYS[2], m)
+	elseif ARGV[3] ~= '1' or redis.call('SADD', KEYS[4], m) == 1 then
+		redis.call('LPUSH', KEYS[3], m)
+	end
+end
+return #ms
+`)
+
+	// looks a message up by id in the index, removes it when it is pending or scheduled and then
+	// deletes it or (re)schedules it when a score is given. The removed message is returned, a pending
+	// message of a group is only deleted and -1 is returned instead when rescheduling it, a pending message
+	// of a tenant is taken off the tenant's backlog. Group and tenant keys are derived from the ARGV[4] and
+	// ARGV[5] prefixes
+	redisRescheduleScript = redis.NewScript(`
+local m = redis.call('HGET', KEYS[5], ARGV[1])
+if not m then
+	return false
+end
+local ok, v = pcall(cjson.decode, m)
+if not ok or type(v) ~= 'table' then
+	v = {}
+end
+if type(v['group_key']) == 'string' and v['group_key'] ~= '' then
+	if ARGV[3] ~= '' then
+		return -1
+	end
+	local list = ARGV[4] .. v['group_key']
+	if redis.call('LREM', list, 1, m) == 0 then
+		return false
+	end
+	if redis.call('LLEN', list) == 0 then
+		redis.call('LREM', KEYS[6], 0, v['group_key'])
+	end
+	redis.call('HDEL', KEYS[5], ARGV[1])
+	return m
+end
+local found = redis.call('ZREM', KEYS[1], m) == 1
+local t = v['tenant_key']
+if not found and type(t) == 'string' and t ~= '' and redis.call('LREM', ARGV[5] .. t, 1, m) == 1 then
+	if redis.call('HINCRBY', KEYS[7], t, -1) <= 0 then
+		redis.call('HDEL', KEYS[7], t)
+		redis.call('HDEL', KEYS[9], t)
+		redis.call('LREM', KEYS[8], 0, t)
+	end
+	found = true
+end
+if not found and ARGV[2] == '1' and redis.call('LREM', KEYS[3], 1, m) == 1 then
+	redis.call('SREM', KEYS[4], m)
+	found = true
+end
+if not found then
+	found = redis.call('SREM', KEYS[2], m) == 1
+end
+if not found then
+	return false
+end
+if ARGV[3] ~= '' then
+	redis.call('ZADD', KEYS[1], ARGV[3], m)
+else
+	redis.call('HDEL', KEYS[5], ARGV[1])
+end
+return m
+`)
+
+	// takes or refreshes the lock of a unique job unless another owner holds it
+	redisLockScript = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+	// releases the lock of a unique job held by owner
+	redisUnlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+	// takes a token of a bucket refilled with ARGV[1] tokens per second holding up to ARGV[2] tokens,
+	// returns how many milliseconds to wait when there is none. ARGV[3] is the caller's time in milliseconds
+	redisTakeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1]) / 1000
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens = tonumber(b[1]) or burst
+local at = tonumber(b[2]) or now
+if now > at then
+	tokens = math.min(burst, tokens + (now - at) * rate)
+	at = now
+end
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'at', tostring(at))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate) + 1000)
+return wait
+`)
+
+	// takes or renews a semaphore slot for ARGV[1] out of ARGV[2] slots, leased until ARGV[3] + ARGV[4] milliseconds,
+	// slots are kept in a sorted set scored by their lease expiry so expired ones are dropped first
+	redisAcquireScript = redis.NewScript(`
+local now = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) and redis.call('ZCARD', KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], now + tonumber(ARGV[4]), ARGV[1])
+return 1
+`)
+
+	// writes to the tail of a message group, the group becomes ready unless it is locked or had messages already
+	redisGroupWriteScript = redis.NewScript(`
+redis.call('LPUSH', KEYS[1], ARGV[1])
+if redis.call('LLEN', KEYS[1]) == 1 and not redis.call('ZSCORE', KEYS[3], ARGV[2]) then
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+end
+if ARGV[3] ~= '' then
+	redis.call('HSET', KEYS[4], ARGV[3], ARGV[1])
+end
+return 1
+`)
+
+	// returns in-flight messages of groups whose lease passed to their head, then moves the oldest message
+	// of the next ready group in flight and locks the group. Group keys are derived from the ARGV[1] prefix
+	redisGroupReadScript = redis.NewScript(`
+local now = tonumber(ARGV[2])
+for _, g in ipairs(redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now)) do
+	local list = ARGV[1] .. g
+	local m = redis.call('RPOP', list .. ':in-flight')
+	while m do
+		redis.call('RPUSH', list, m)
+		m = redis.call('RPOP', list .. ':in-flight')
+	end
+	redis.call('ZREM', KEYS[2], g)
+	if redis.call('LLEN', list) > 0 then
+		redis.call('RPUSH', KEYS[1], g)
+	end
+end
+local g = redis.call('RPOP', KEYS[1])
+while g do
+	local list = ARGV[1] .. g
+	local m = redis.call('RPOP', list)
+	if m then
+		redis.call('LPUSH', list .. ':in-flight', m)
+		redis.call('ZADD', KEYS[2], now + tonumber(ARGV[3]), g)
+		return {g, m}
+	end
+	g = redis.call('RPOP', KEYS[1])
+end
+return false
+`)
+
+	// keeps a group locked until ARGV[3] while ARGV[1] is its in-flight message
+	redisGroupRenewScript = redis.NewScript(`
+for _, m in ipairs(redis.call('LRANGE', KEYS[1], 0, -1)) do
+	if m == ARGV[1] then
+		redis.call('ZADD', KEYS[2], ARGV[3], ARGV[2])
+		return 1
+	end
+end
+return 0
+`)
+
+	// removes a message of a group from in flight and unlocks the group
+	redisGroupAckScript = redis.NewScript(`
+if redis.call('LREM', KEYS[2], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZREM', KEYS[4], ARGV[2])
+if redis.call('LLEN', KEYS[1]) > 0 then
+	redis.call('LPUSH', KEYS[3], ARGV[2])
+end
+if ARGV[3] ~= '' and redis.call('HGET', KEYS[5], ARGV[3]) == ARGV[1] then
+	redis.call('HDEL', KEYS[5], ARGV[3])
+end
+return 1
+`)
+
+	// replaces an in-flight message of a group, the group stays locked until ARGV[4]
+	redisGroupNackScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('LPUSH', KEYS[1], ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[4], ARGV[3])
+if ARGV[5] ~= '' then
+	redis.call('HSET', KEYS[3], ARGV[5], ARGV[2])
+end
+return 1
+`)
+
+	// writes to the tail of a tenant, a tenant without pending messages joins the tail of the ready tenants
+	redisTenantWriteScript = redis.NewScript(`
+redis.call('LPUSH', KEYS[1], ARGV[1])
+if redis.call('HINCRBY', KEYS[2], ARGV[2], 1) == 1 then
+	redis.call('LPUSH', KEYS[3], ARGV[2])
+end
+if ARGV[3] ~= '' then
+	redis.call('HSET', KEYS[4], ARGV[3], ARGV[1])
+end
+return 1
+`)
+
+	// moves the oldest message of the tenant at the head of the ready tenants in flight, the tenant moves to
+	// the tail once it has been read weight times in a row. Weights are ARGV[3..] tenant, weight pairs
+	redisTenantReadScript = redis.NewScript(`
+while true do
+	local t = redis.call('LINDEX', KEYS[1], -1)
+	if not t then
+		return false
+	end
+	local m = redis.call('RPOP', ARGV[1] .. t)
+	if m then
+		local weight = tonumber(ARGV[2])
+		for i = 3, #ARGV, 2 do
+			if ARGV[i] == t then
+				weight = tonumber(ARGV[i + 1])
+			end
+		end
+		if redis.call('HINCRBY', KEYS[2], t, -1) <= 0 then
+			redis.call('HDEL', KEYS[2], t)
+			redis.call('HDEL', KEYS[3], t)
+			redis.call('RPOP', KEYS[1])
+		elseif redis.call('HINCRBY', KEYS[3], t, 1) >= weight then
+			redis.call('HDEL', KEYS[3], t)
+			redis.call('RPOPLPUSH', KEYS[1], KEYS[1])
+		end
+		redis.call('LPUSH', KEYS[4], m)
+		return {t, m}
+	end
+	redis.call('RPOP', KEYS[1])
+	redis.call('HDEL', KEYS[2], t)
+	redis.call('HDEL', KEYS[3], t)
+end
+`)
+
+	// returns an in-flight message to the head of its tenant
+	redisTenantNackScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('RPUSH', KEYS[2], ARGV[1])
+if redis.call('HINCRBY', KEYS[3], ARGV[2], 1) == 1 then
+	redis.call('RPUSH', KEYS[4], ARGV[2])
+end
+return 1
+`)
+
+	// moves every message of the set layout to the head of the active list
+	redisMigrateScript = redis.NewScript(`
+local ms = redis.call('SMEMBERS', KEYS[1])
+for _, m in ipairs(ms) do
+	redis.call('RPUSH', KEYS[2], m)
+end
+redis.call('DEL', KEYS[1])
+return #ms
+`)
+)
+
+// RedisOption configures a RedisQueueDriver
+type RedisOption func(rqd *RedisQueueDriver)
+
+// WithRedisConsumer sets the name the driver keeps its in-flight messages under,
+// a stable name (e.g. pod name) lets a restarted process recover messages it never acknowledged right away,
+// messages of consumers which never come back are reaped once their heartbeat expires (see InFlightReaper)
+func WithRedisConsumer(name string) RedisOption {
+	return func(rqd *RedisQueueDriver) {
+		rqd.consumer = name
+	}
+}
+
+// WithRedisMode sets the layout pending messages are stored in, RedisModeSet by default
+func WithRedisMode(mode RedisMode) RedisOption {
+	return func(rqd *RedisQueueDriver) {
+		rqd.mode = mode
+	}
+}
+
+// WithRedisDedup drops writes of messages identical to an already pending one in RedisModeList
+func WithRedisDedup() RedisOption {
+	return func(rqd *RedisQueueDriver) {
+		rqd.dedup = true
+	}
+}
+
 // NewRedisQueueDriver initializes and returns a pointer to a new redis driver instance
-func NewRedisQueueDriver(r redis.Cmdable) *RedisQueueDriver {
-	return &RedisQueueDriver{r}
+func NewRedisQueueDriver(r redis.Cmdable, opts ...RedisOption) *RedisQueueDriver {
+	rqd := &RedisQueueDriver{redisStats: redisStats{r}, consumer: uuid.New().String()}
+
+	for _, opt := range opts {
+		opt(rqd)
+	}
+
+	return rqd
 }
 
 // RedisQueueDriver is a queue driver implementation for queue driver
 type RedisQueueDriver struct {
-	r redis.Cmdable
+	redisStats
+
+	consumer string
+	mode     RedisMode
+	dedup    bool
+
+	// levels holds the priority levels recorded by addLevel
+	levels sync.Map
 }
 
 // Write writes to active queue to be executed immediately
-func (rqd *RedisQueueDriver) Write(queue string, d []byte) error {
-	return rqd.r.SAdd(fmt.Sprintf("%s:active", queue), d).Err()
+func (rqd *RedisQueueDriver) Write(ctx context.Context, queue string, d []byte) error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err := rqd.addLevel(r, queue); err != nil {
+		return err
+	}
+
+	return redisWriteScript.Run(r, rqd.writeKeys(queue), rqd.writeArgs(d)...).Err()
 }
 
-// Read from queue
-func (rqd *RedisQueueDriver) Read(queue string) ([]byte, error) {
-	return rqd.r.SPop(fmt.Sprintf("%s:active", queue)).Bytes()
+// WriteBatch writes many messages in a single pipelined round trip,
+// messages are written one by one so some may fail while others are written
+func (rqd *RedisQueueDriver) WriteBatch(ctx context.Context, queue string, ds [][]byte) []error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return batchErrors(len(ds), err)
+	}
+
+	if err := rqd.addLevel(r, queue); err != nil {
+		return batchErrors(len(ds), err)
+	}
+
+	// the script is loaded first so pipelined calls can run it by its hash
+	if err := redisWriteScript.Load(r).Err(); err != nil {
+		return batchErrors(len(ds), err)
+	}
+
+	cmds, _ := r.Pipelined(func(p redis.Pipeliner) error {
+		for _, d := range ds {
+			redisWriteScript.EvalSha(p, rqd.writeKeys(queue), rqd.writeArgs(d)...)
+		}
+
+		return nil
+	})
+
+	return cmdErrors(cmds)
+}
+
+// Read moves a message from queue into the consumer's in-flight list and returns it
+func (rqd *RedisQueueDriver) Read(ctx context.Context, queue string) ([]byte, error) {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var cmd *redis.Cmd
+
+	if rqd.mode == RedisModeList {
+		cmd = redisListReadScript.Run(r, []string{
+			rqd.listKey(queue),
+			rqd.setKey(queue),
+			rqd.inFlightKey(queue, rqd.consumer),
+			rqd.membersKey(queue),
+		})
+	} else {
+		cmd = redisReadScript.Run(r, []string{rqd.setKey(queue), rqd.inFlightKey(queue, rqd.consumer)})
+	}
+
+	s, err := cmd.String()
+
+	return []byte(s), err
+}
+
+// ReadFirst reads from the first non empty queue in a single round trip
+func (rqd *RedisQueueDriver) ReadFirst(ctx context.Context, queues []string) (int, []byte, error) {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	keys := make([]string, 0, 4*len(queues))
+
+	for _, queue := range queues {
+		keys = append(keys, rqd.listKey(queue), rqd.setKey(queue), rqd.inFlightKey(queue, rqd.consumer), rqd.membersKey(queue))
+	}
+
+	v, err := redisReadFirstScript.Run(r, keys, rqd.mode == RedisModeList).Result()
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	res, ok := v.([]interface{})
+
+	if !ok || len(res) != 2 {
+		return 0, nil, fmt.Errorf("unexpected read result %v", v)
+	}
+
+	i, _ := res[0].(int64)
+	d, _ := res[1].(string)
+
+	return int(i), []byte(d), nil
+}
+
+// ReadBlocking waits up to timeout for a message in RedisModeList,
+// ErrNotSupported is returned in RedisModeSet as sets can not be waited on
+func (rqd *RedisQueueDriver) ReadBlocking(ctx context.Context, queue string, timeout time.Duration) ([]byte, error) {
+	if rqd.mode != RedisModeList {
+		return nil, ErrNotSupported
+	}
+
+	// messages left in the set layout are only read by Read
+	if d, err := rqd.Read(ctx, queue); err != redis.Nil {
+		return d, err
+	}
+
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := r.BRPopLPush(rqd.listKey(queue), rqd.inFlightKey(queue, rqd.consumer), blockFor(ctx, timeout, time.Second)).Bytes()
+
+	if err == nil && rqd.dedup {
+		// the message is in flight already, a stale member only drops an identical write
+		_ = r.SRem(rqd.membersKey(queue), d).Err()
+	}
+
+	return d, err
+}
+
+// Ack removes a message from the in-flight list once it has been handled
+func (rqd *RedisQueueDriver) Ack(ctx context.Context, queue string, d []byte) error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	keys := []string{rqd.inFlightKey(queue, rqd.consumer), idsKey(queue)}
+
+	return redisAckScript.Run(r, keys, d, messageID(d)).Err()
+}
+
+// Nack returns an in-flight message back to the queue
+func (rqd *RedisQueueDriver) Nack(ctx context.Context, queue string, d []byte) error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if rqd.mode == RedisModeList {
+		keys := []string{rqd.listKey(queue), rqd.inFlightKey(queue, rqd.consumer), rqd.membersKey(queue)}
+
+		return redisListNackScript.Run(r, keys, d, rqd.dedup).Err()
+	}
+
+	return redisNackScript.Run(r, []string{rqd.setKey(queue), rqd.inFlightKey(queue, rqd.consumer)}, d).Err()
+}
+
+// Schedule holds a message back until at
+func (rqd *RedisQueueDriver) Schedule(ctx context.Context, queue string, d []byte, at time.Time) error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err := rqd.addLevel(r, queue); err != nil {
+		return err
+	}
+
+	return schedule(r, queue, d, at)
+}
+
+// Promote moves messages scheduled until a given time into the active queue, messages of tenants back to their tenant
+func (rqd *RedisQueueDriver) Promote(ctx context.Context, queue string, until time.Time) (int64, error) {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	keys := []string{
+		scheduledKey(queue), rqd.setKey(queue), rqd.listKey(queue), rqd.membersKey(queue),
+		tenantsKey(queue), tenantsReadyKey(queue),
+	}
+
+	return redisPromoteScript.Run(r, keys, unixMilli(until), rqd.mode == RedisModeList, rqd.dedup, tenantKey(queue, "")).Int64()
+}
+
+// Reschedule moves a pending or scheduled message to be executed at a given time, ErrGroupedMessage
+// is returned for messages of groups
+func (rqd *RedisQueueDriver) Reschedule(ctx context.Context, queue string, id string, at time.Time) error {
+	_, err := rqd.reschedule(ctx, queue, id, unixMilli(at))
+
+	return err
+}
+
+// Delete removes a pending, scheduled or grouped message and returns it
+func (rqd *RedisQueueDriver) Delete(ctx context.Context, queue string, id string) ([]byte, error) {
+	return rqd.reschedule(ctx, queue, id, "")
+}
+
+// WriteGroup writes to the tail of a message group
+func (rqd *RedisQueueDriver) WriteGroup(ctx context.Context, queue string, group string, d []byte) error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	keys := []string{groupKey(queue, group), groupsReadyKey(queue), groupsLockedKey(queue), idsKey(queue)}
+
+	return redisGroupWriteScript.Run(r, keys, d, group, messageID(d)).Err()
+}
+
+// ReadGroup moves the oldest message of the next ready group in flight and locks the group until lease passes,
+// group keys are derived inside the script so groups are not supported on redis cluster
+func (rqd *RedisQueueDriver) ReadGroup(ctx context.Context, queue string, lease time.Duration) (string, []byte, error) {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	keys := []string{groupsReadyKey(queue), groupsLockedKey(queue)}
+	v, err := redisGroupReadScript.Run(r, keys, groupKey(queue, ""), int64(unixMilli(time.Now())), lease.Milliseconds()).Result()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	res, ok := v.([]interface{})
+
+	if !ok || len(res) != 2 {
+		return "", nil, fmt.Errorf("unexpected read result %v", v)
+	}
+
+	group, _ := res[0].(string)
+	d, _ := res[1].(string)
+
+	return group, []byte(d), nil
+}
+
+// RenewGroup keeps a group locked until lease passes while d is its in-flight message
+func (rqd *RedisQueueDriver) RenewGroup(ctx context.Context, queue string, group string, d []byte, lease time.Duration) (bool, error) {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	keys := []string{groupKey(queue, group) + ":in-flight", groupsLockedKey(queue)}
+	renewed, err := redisGroupRenewScript.Run(r, keys, d, group, int64(unixMilli(time.Now().Add(lease)))).Int64()
+
+	return renewed == 1, err
+}
+
+// AckGroup removes a message of a group from in flight and unlocks the group
+func (rqd *RedisQueueDriver) AckGroup(ctx context.Context, queue string, group string, d []byte) error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	key := groupKey(queue, group)
+	keys := []string{key, key + ":in-flight", groupsReadyKey(queue), groupsLockedKey(queue), idsKey(queue)}
+
+	return redisGroupAckScript.Run(r, keys, d, group, messageID(d)).Err()
+}
+
+// NackGroup replaces an in-flight message of a group by retry, the group stays locked until at
+func (rqd *RedisQueueDriver) NackGroup(ctx context.Context, queue string, group string, d []byte, retry []byte, at time.Time) error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	keys := []string{groupKey(queue, group) + ":in-flight", groupsLockedKey(queue), idsKey(queue)}
+
+	return redisGroupNackScript.Run(r, keys, d, retry, group, int64(unixMilli(at)), messageID(retry)).Err()
+}
+
+// WriteTenant writes to the tail of a tenant
+func (rqd *RedisQueueDriver) WriteTenant(ctx context.Context, queue string, tenant string, d []byte) error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if err := rqd.addLevel(r, queue); err != nil {
+		return err
+	}
+
+	keys := []string{tenantKey(queue, tenant), tenantsKey(queue), tenantsReadyKey(queue), idsKey(queue)}
+
+	return redisTenantWriteScript.Run(r, keys, d, tenant, messageID(d)).Err()
+}
+
+// ReadTenant moves the oldest message of the next ready tenant into the consumer's in-flight list,
+// tenants are read up to their weight in a row before the next one
+func (rqd *RedisQueueDriver) ReadTenant(ctx context.Context, queue string, weights map[string]int) (string, []byte, error) {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	keys := []string{tenantsReadyKey(queue), tenantsKey(queue), tenantsServedKey(queue), rqd.inFlightKey(queue, rqd.consumer)}
+	args := []interface{}{tenantKey(queue, ""), 1}
+
+	for tenant, weight := range weights {
+		args = append(args, tenant, weight)
+	}
+
+	v, err := redisTenantReadScript.Run(r, keys, args...).Result()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	res, ok := v.([]interface{})
+
+	if !ok || len(res) != 2 {
+		return "", nil, fmt.Errorf("unexpected read result %v", v)
+	}
+
+	tenant, _ := res[0].(string)
+	d, _ := res[1].(string)
+
+	return tenant, []byte(d), nil
+}
+
+// NackTenant returns an in-flight message to the head of its tenant
+func (rqd *RedisQueueDriver) NackTenant(ctx context.Context, queue string, tenant string, d []byte) error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	keys := []string{rqd.inFlightKey(queue, rqd.consumer), tenantKey(queue, tenant), tenantsKey(queue), tenantsReadyKey(queue)}
+
+	return redisTenantNackScript.Run(r, keys, d, tenant).Err()
+}
+
+// RecoverInFlight returns every message left unacknowledged by consumer back to queue, messages of
+// tenants back to their tenant. It should be used for consumers that are known to be dead
+func (rqd *RedisQueueDriver) RecoverInFlight(ctx context.Context, queue string, consumer string) (int64, error) {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	script := redisRecoverScript
+	key := rqd.setKey(queue)
+
+	if rqd.mode == RedisModeList {
+		script = redisListRecoverScript
+		key = rqd.listKey(queue)
+	}
+
+	keys := []string{key, rqd.inFlightKey(queue, consumer), tenantsKey(queue), tenantsReadyKey(queue)}
+
+	return script.Run(r, keys, tenantKey(queue, "")).Int64()
+}
+
+// Heartbeat keeps the consumer of the driver alive for ttl, ttl should exceed the clock skew between processes
+func (rqd *RedisQueueDriver) Heartbeat(ctx context.Context, queue string, ttl time.Duration) error {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return r.ZAdd(consumersKey(queue), redis.Z{Score: unixMilli(time.Now().Add(ttl)), Member: rqd.consumer}).Err()
+}
+
+// Reap returns messages left in flight by consumers whose heartbeat expired back to queue
+func (rqd *RedisQueueDriver) Reap(ctx context.Context, queue string) (int64, error) {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	now := strconv.FormatFloat(unixMilli(time.Now()), 'f', 0, 64)
+	dead, err := r.ZRangeByScore(consumersKey(queue), redis.ZRangeBy{Min: "-inf", Max: now}).Result()
+
+	if err != nil {
+		return 0, err
+	}
+
+	var reaped int64
+
+	for _, consumer := range dead {
+		if consumer == rqd.consumer {
+			continue
+		}
+
+		n, err := rqd.RecoverInFlight(ctx, queue, consumer)
+
+		if err != nil {
+			return reaped, err
+		}
+
+		reaped += n
+
+		if err := r.ZRem(consumersKey(queue), consumer).Err(); err != nil {
+			return reaped, err
+		}
+	}
+
+	return reaped, nil
+}
+
+// MigrateSetToList moves messages stored in the RedisModeSet layout into the RedisModeList one,
+// they are placed ahead of messages already in the list as they are older
+func (rqd *RedisQueueDriver) MigrateSetToList(ctx context.Context, queue string) (int64, error) {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return redisMigrateScript.Run(r, []string{rqd.setKey(queue), rqd.listKey(queue)}).Int64()
+}
+
+// Register registers a new queue (should not be additive)
+// messages left in flight by a previous run of the same consumer are returned to the queue
+// and to each of its priority levels written to so far
+func (rqd *RedisQueueDriver) Register(ctx context.Context, queue string) error {
+	if err := rqd.register(ctx, queue); err != nil {
+		return err
+	}
+
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	active := fmt.Sprintf("%s:active:%s", queuePrefix, queue)
+	levels, err := r.SMembers(levelsKey(active)).Result()
+
+	if err != nil {
+		return err
+	}
+
+	for _, q := range append([]string{active}, levels...) {
+		if _, err := rqd.RecoverInFlight(ctx, q, rqd.consumer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reschedule returns the message it deleted or rescheduled
+func (rqd *RedisQueueDriver) reschedule(ctx context.Context, queue string, id string, score interface{}) ([]byte, error) {
+	r, err := rqd.conn(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{
+		scheduledKey(queue), rqd.setKey(queue), rqd.listKey(queue), rqd.membersKey(queue), idsKey(queue),
+		groupsReadyKey(queue), tenantsKey(queue), tenantsReadyKey(queue), tenantsServedKey(queue),
+	}
+	args := []interface{}{id, rqd.mode == RedisModeList, score, groupKey(queue, ""), tenantKey(queue, "")}
+
+	v, err := redisRescheduleScript.Run(r, keys, args...).Result()
+
+	if err == redis.Nil {
+		return nil, ErrMessageNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	d, ok := v.(string)
+
+	if !ok {
+		return nil, ErrGroupedMessage
+	}
+
+	return []byte(d), nil
+}
+
+func (rqd *RedisQueueDriver) writeKeys(queue string) []string {
+	return []string{rqd.setKey(queue), rqd.listKey(queue), rqd.membersKey(queue), idsKey(queue)}
+}
+
+func (rqd *RedisQueueDriver) writeArgs(d []byte) []interface{} {
+	return []interface{}{d, messageID(d), rqd.mode == RedisModeList, rqd.dedup}
+}
+
+func (rqd *RedisQueueDriver) inFlightKey(queue string, consumer string) string {
+	return fmt.Sprintf("%s:in-flight:%s", queue, consumer)
+}
+
+func (rqd *RedisQueueDriver) setKey(queue string) string {
+	return fmt.Sprintf("%s:active", queue)
+}
+
+func (rqd *RedisQueueDriver) listKey(queue string) string {
+	return fmt.Sprintf("%s:list", queue)
+}
+
+func (rqd *RedisQueueDriver) membersKey(queue string) string {
+	return fmt.Sprintf("%s:list:members", queue)
+}
+
+// redisStats keeps queue statistics and dead letters, shared by the redis based drivers
+type redisStats struct {
+	r redis.Cmdable
 }
 
 // SetProcessed increments processed amount
-func (rqd *RedisQueueDriver) SetProcessed(queue string) error {
-	return rqd.r.Incr(fmt.Sprintf("%s:processed", queue)).Err()
+func (rs *redisStats) SetProcessed(ctx context.Context, queue string) error {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return r.Incr(fmt.Sprintf("%s:processed", queue)).Err()
 }
 
 // SetFailed increments fail data
-func (rqd *RedisQueueDriver) SetFailed(queue string, taskID string) error {
-	return rqd.r.SAdd(fmt.Sprintf("%s:failed", queue), taskID).Err()
+func (rs *redisStats) SetFailed(ctx context.Context, queue string, taskID string) error {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return r.SAdd(fmt.Sprintf("%s:failed", queue), taskID).Err()
 }
 
-// Register registers a new queue (should not be additive)
-func (rqd *RedisQueueDriver) Register(queue string) error {
-	return rqd.r.SAdd(fmt.Sprintf("%s:queue-list", queuePrefix), queue).Err()
+// SetExpired increments expired amount
+func (rs *redisStats) SetExpired(ctx context.Context, queue string) error {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return r.Incr(fmt.Sprintf("%s:expired", queue)).Err()
 }
 
 // GetStats returns available queue statistics
-func (rqd *RedisQueueDriver) GetStats() (*Stats, error) {
-	queues := rqd.r.SMembers(fmt.Sprintf("%s:queue-list", queuePrefix)).Val()
+func (rs *redisStats) GetStats(ctx context.Context) (*Stats, error) {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queues := r.SMembers(fmt.Sprintf("%s:queue-list", queuePrefix)).Val()
 
 	var stats = Stats{}
 
 	for _, q := range queues {
-		proc, _ := rqd.r.Get(fmt.Sprintf("%s:%s:processed", queuePrefix, q)).Int64()
-		failed := rqd.r.SMembers(fmt.Sprintf("%s:%s:failed", queuePrefix, q)).Val()
+		proc, _ := r.Get(fmt.Sprintf("%s:%s:processed", queuePrefix, q)).Int64()
+		expired, _ := r.Get(fmt.Sprintf("%s:%s:expired", queuePrefix, q)).Int64()
+		failed := r.SMembers(fmt.Sprintf("%s:%s:failed", queuePrefix, q)).Val()
+		backlogs, err := rs.tenantBacklogs(r, fmt.Sprintf("%s:active:%s", queuePrefix, q))
+
+		if err != nil {
+			return nil, err
+		}
 
 		stats[q] = Stat{
-			Processed: proc,
-			Failed:    len(failed),
-			FailedIDs: failed,
+			Processed:      proc,
+			Expired:        expired,
+			Failed:         len(failed),
+			FailedIDs:      failed,
+			TenantBacklogs: backlogs,
 		}
 	}
 
 	return &stats, nil
 }
+
+// tenantBacklogs sums pending messages of each tenant over the priority levels of an active queue,
+// the levels are read from the set recorded on writes rather than by scanning the keyspace
+func (rs *redisStats) tenantBacklogs(r redis.Cmdable, active string) (map[string]int64, error) {
+	levels, err := r.SMembers(levelsKey(active)).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{tenantsKey(active)}
+
+	for _, level := range levels {
+		keys = append(keys, tenantsKey(level))
+	}
+
+	var backlogs map[string]int64
+
+	for _, key := range keys {
+		for tenant, v := range r.HGetAll(key).Val() {
+			n, _ := strconv.ParseInt(v, 10, 64)
+
+			if backlogs == nil {
+				backlogs = map[string]int64{}
+			}
+
+			backlogs[tenant] += n
+		}
+	}
+
+	return backlogs, nil
+}
+
+// Claim claims an idempotency key for window unless it is claimed already
+func (rs *redisStats) Claim(ctx context.Context, queue string, key string, window time.Duration) (bool, error) {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	return r.SetNX(fmt.Sprintf("%s:idempotency:%s", queue, key), 1, window).Result()
+}
+
+// Release forgets a claimed idempotency key
+func (rs *redisStats) Release(ctx context.Context, queue string, key string) error {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return r.Del(fmt.Sprintf("%s:idempotency:%s", queue, key)).Err()
+}
+
+// Lock takes or refreshes the lock of a unique job unless another owner holds it
+func (rs *redisStats) Lock(ctx context.Context, queue string, key string, owner string, ttl time.Duration) (bool, error) {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	locked, err := redisLockScript.Run(r, []string{fmt.Sprintf("%s:unique:%s", queue, key)}, owner, ttl.Milliseconds()).Int64()
+
+	return locked == 1, err
+}
+
+// Unlock releases the lock of a unique job held by owner
+func (rs *redisStats) Unlock(ctx context.Context, queue string, key string, owner string) error {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return redisUnlockScript.Run(r, []string{fmt.Sprintf("%s:unique:%s", queue, key)}, owner).Err()
+}
+
+// Take takes a token of the queue's token bucket, the bucket is shared by every process
+// so their clocks should be roughly in sync
+func (rs *redisStats) Take(ctx context.Context, queue string, rate float64, burst int) (time.Duration, error) {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	keys := []string{fmt.Sprintf("%s:rate-limit", queue)}
+	wait, err := redisTakeScript.Run(r, keys, rate, burst, int64(unixMilli(time.Now()))).Int64()
+
+	return time.Duration(wait) * time.Millisecond, err
+}
+
+// AcquireSlot takes or renews a slot of the queue's semaphore, the semaphore is shared by every process
+// so their clocks should be roughly in sync
+func (rs *redisStats) AcquireSlot(ctx context.Context, queue string, holder string, limit int, ttl time.Duration) (bool, error) {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	keys := []string{fmt.Sprintf("%s:semaphore", queue)}
+	acquired, err := redisAcquireScript.Run(r, keys, holder, limit, int64(unixMilli(time.Now())), ttl.Milliseconds()).Int64()
+
+	return acquired == 1, err
+}
+
+// ReleaseSlot frees the semaphore slot of holder
+func (rs *redisStats) ReleaseSlot(ctx context.Context, queue string, holder string) error {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return r.ZRem(fmt.Sprintf("%s:semaphore", queue), holder).Err()
+}
+
+// AddDeadLetter keeps a message which failed max attempts
+func (rs *redisStats) AddDeadLetter(ctx context.Context, queue string, id string, d []byte) error {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return r.HSet(fmt.Sprintf("%s:dead-letters", queue), id, d).Err()
+}
+
+// GetDeadLetters returns every message which failed max attempts
+func (rs *redisStats) GetDeadLetters(ctx context.Context, queue string) ([][]byte, error) {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ls, err := r.HVals(fmt.Sprintf("%s:dead-letters", queue)).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var ds = make([][]byte, 0, len(ls))
+
+	for _, l := range ls {
+		ds = append(ds, []byte(l))
+	}
+
+	return ds, nil
+}
+
+// GetDeadLetter returns a single message which failed max attempts
+func (rs *redisStats) GetDeadLetter(ctx context.Context, queue string, id string) ([]byte, error) {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := r.HGet(fmt.Sprintf("%s:dead-letters", queue), id).Bytes()
+
+	if err == redis.Nil {
+		return nil, ErrMessageNotFound
+	}
+
+	return d, err
+}
+
+// DeleteDeadLetter removes a message which failed max attempts
+func (rs *redisStats) DeleteDeadLetter(ctx context.Context, queue string, id string) error {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	n, err := r.HDel(fmt.Sprintf("%s:dead-letters", queue), id).Result()
+
+	if err == nil && n == 0 {
+		return ErrMessageNotFound
+	}
+
+	return err
+}
+
+// conn returns the client to run a command of ctx with, go-redis v6 never interrupts
+// a command once it is sent so a done ctx is reported before anything is sent
+func (rs *redisStats) conn(ctx context.Context) (redis.Cmdable, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return rs.r, nil
+}
+
+func (rs *redisStats) register(ctx context.Context, queue string) error {
+	r, err := rs.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return r.SAdd(fmt.Sprintf("%s:queue-list", queuePrefix), queue).Err()
+}
+
+// consumersKey is the sorted set of consumers reading queue scored by their heartbeat expiry
+func consumersKey(queue string) string {
+	return fmt.Sprintf("%s:consumers", queue)
+}
+
+// tenantKey is the list holding pending messages of a tenant
+func tenantKey(queue string, tenant string) string {
+	return fmt.Sprintf("%s:tenant:%s", queue, tenant)
+}
+
+// tenantsKey is the hash of pending message counts by tenant
+func tenantsKey(queue string) string {
+	return fmt.Sprintf("%s:tenants", queue)
+}
+
+// tenantsReadyKey is the list of tenants with pending messages, read from its head
+func tenantsReadyKey(queue string) string {
+	return fmt.Sprintf("%s:tenants:ready", queue)
+}
+
+// tenantsServedKey is the hash of reads in a row of the tenant at the head of the ready tenants
+func tenantsServedKey(queue string) string {
+	return fmt.Sprintf("%s:tenants:served", queue)
+}
+
+// addLevel records a priority level of an active queue written to for the first time by the process,
+// so the levels of a queue can be listed without scanning the keyspace
+func (rqd *RedisQueueDriver) addLevel(r redis.Cmdable, queue string) error {
+	i := strings.LastIndex(queue, ":priority:")
+
+	if i < 0 {
+		return nil
+	}
+
+	if _, ok := rqd.levels.Load(queue); ok {
+		return nil
+	}
+
+	if err := r.SAdd(levelsKey(queue[:i]), queue).Err(); err != nil {
+		return err
+	}
+
+	rqd.levels.Store(queue, struct{}{})
+
+	return nil
+}
+
+// isTenantsKey reports whether key is the tenantsKey of the active queue or of one of its priority levels
+func isTenantsKey(active string, key string) bool {
+	level := strings.TrimPrefix(key, active+":priority:")
+
+	return key == tenantsKey(active) ||
+		(level != key && strings.HasSuffix(level, ":tenants") && strings.Count(level, ":") == 1)
+}
+
+// groupKey is the list holding pending messages of a group, its in-flight message is kept under groupKey:in-flight
+func groupKey(queue string, group string) string {
+	return fmt.Sprintf("%s:group:%s", queue, group)
+}
+
+// groupsReadyKey is the list of unlocked groups with pending messages
+func groupsReadyKey(queue string) string {
+	return fmt.Sprintf("%s:groups:ready", queue)
+}
+
+// groupsLockedKey is the sorted set of locked groups scored by their lease expiry
+func groupsLockedKey(queue string) string {
+	return fmt.Sprintf("%s:groups:locked", queue)
+}
+
+// levelsKey is the set of priority levels messages of an active queue were written to
+func levelsKey(active string) string {
+	return fmt.Sprintf("%s:levels", active)
+}
+
+// idsKey is the hash indexing pending, scheduled and in-flight messages by their ID so they are looked up
+// without scanning the queue, entries are removed once messages are acknowledged
+func idsKey(queue string) string {
+	return fmt.Sprintf("%s:ids", queue)
+}
+
+// schedule holds a message back until at and indexes it
+func schedule(r redis.Cmdable, queue string, d []byte, at time.Time) error {
+	_, err := r.TxPipelined(func(p redis.Pipeliner) error {
+		p.ZAdd(scheduledKey(queue), redis.Z{Score: unixMilli(at), Member: d})
+
+		if id := messageID(d); id != "" {
+			p.HSet(idsKey(queue), id, d)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+func scheduledKey(queue string) string {
+	return fmt.Sprintf("%s:scheduled", queue)
+}
+
+// batchErrors returns err for every message of a batch
+func batchErrors(n int, err error) []error {
+	errs := make([]error, n)
+
+	for i := range errs {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// cmdErrors returns the error of every pipelined command
+func cmdErrors(cmds []redis.Cmder) []error {
+	errs := make([]error, len(cmds))
+
+	for i, cmd := range cmds {
+		errs[i] = cmd.Err()
+	}
+
+	return errs
+}
+
+// blockFor bounds how long a blocking command may wait by the deadline of ctx,
+// min is the smallest wait the command supports as 0 means forever
+func blockFor(ctx context.Context, timeout time.Duration, min time.Duration) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+
+	if timeout < min {
+		return min
+	}
+
+	return timeout
+}
+
+func unixMilli(t time.Time) float64 {
+	return float64(t.UnixNano() / int64(time.Millisecond))
+}
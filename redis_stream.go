@@ -0,0 +1,438 @@
+package simpleq
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	streamField          = "data"
+	defaultStreamGroup   = "simpleq"
+	defaultStreamIdleFor = 5 * time.Minute
+)
+
+// claims a single entry abandoned by another consumer of the group
+var redisClaimScript = redis.NewScript(`
+local r = redis.call('XAUTOCLAIM', KEYS[1], ARGV[1], ARGV[2], ARGV[3], '0-0', 'COUNT', 1)
+for _, e in ipairs(r[2]) do
+	if e and e[2] then
+		for i = 1, #e[2], 2 do
+			if e[2][i] == ARGV[4] then
+				return {e[1], e[2][i + 1]}
+			end
+		end
+	end
+end
+return false
+`)
+
+// appends a message to the stream and indexes it along with its entry by its id ARGV[3]
+var redisStreamWriteScript = redis.NewScript(`
+local e = redis.call('XADD', KEYS[1], '*', ARGV[1], ARGV[2])
+if ARGV[3] ~= '' then
+	redis.call('HSET', KEYS[2], ARGV[3], ARGV[2])
+	redis.call('HSET', KEYS[3], ARGV[3], e)
+end
+return e
+`)
+
+// acknowledges and deletes entry ARGV[2], index entries of its message id ARGV[3] are removed unless
+// a retry replaced them
+var redisStreamAckScript = redis.NewScript(`
+redis.call('XACK', KEYS[1], ARGV[1], ARGV[2])
+redis.call('XDEL', KEYS[1], ARGV[2])
+if ARGV[3] ~= '' and redis.call('HGET', KEYS[3], ARGV[3]) == ARGV[2] then
+	redis.call('HDEL', KEYS[3], ARGV[3])
+	if redis.call('HGET', KEYS[2], ARGV[3]) == ARGV[4] then
+		redis.call('HDEL', KEYS[2], ARGV[3])
+	end
+end
+return 1
+`)
+
+// appends due scheduled messages to the stream and indexes their entries
+var redisStreamPromoteScript = redis.NewScript(`
+local ms = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 1000)
+for _, m in ipairs(ms) do
+	redis.call('ZREM', KEYS[1], m)
+	local e = redis.call('XADD', KEYS[2], '*', ARGV[2], m)
+	local ok, v = pcall(cjson.decode, m)
+	if ok and type(v) == 'table' and type(v['id']) == 'string' then
+		redis.call('HSET', KEYS[3], v['id'], e)
+	end
+end
+return #ms
+`)
+
+// looks a message up by id in the index, removes it when it is scheduled or not delivered yet and then
+// deletes it or (re)schedules it when a score is given. The removed message is returned
+var redisStreamRescheduleScript = redis.NewScript(`
+local m = redis.call('HGET', KEYS[3], ARGV[1])
+if not m then
+	return false
+end
+if redis.call('ZREM', KEYS[1], m) == 0 then
+	local e = redis.call('HGET', KEYS[4], ARGV[1])
+	if not e then
+		return false
+	end
+	local ok, p = pcall(redis.call, 'XPENDING', KEYS[2], ARGV[2], e, e, 1)
+	if ok and #p > 0 then
+		return false
+	end
+	if redis.call('XDEL', KEYS[2], e) == 0 then
+		return false
+	end
+	redis.call('HDEL', KEYS[4], ARGV[1])
+end
+if ARGV[3] ~= '' then
+	redis.call('ZADD', KEYS[1], ARGV[3], m)
+else
+	redis.call('HDEL', KEYS[3], ARGV[1])
+end
+return m
+`)
+
+// RedisStreamOption configures a RedisStreamDriver
+type RedisStreamOption func(rsd *RedisStreamDriver)
+
+// WithStreamGroup sets the consumer group shared by every process reading the queue
+func WithStreamGroup(group string) RedisStreamOption {
+	return func(rsd *RedisStreamDriver) {
+		rsd.group = group
+	}
+}
+
+// WithStreamConsumer sets the name of the consumer inside the group
+func WithStreamConsumer(consumer string) RedisStreamOption {
+	return func(rsd *RedisStreamDriver) {
+		rsd.consumer = consumer
+	}
+}
+
+// WithStreamClaimIdle sets how long a message may stay pending on a consumer
+// before it is considered abandoned and claimed by another one
+func WithStreamClaimIdle(d time.Duration) RedisStreamOption {
+	return func(rsd *RedisStreamDriver) {
+		rsd.claimIdle = d
+	}
+}
+
+// NewRedisStreamDriver initializes and returns a pointer to a new redis stream driver instance
+func NewRedisStreamDriver(r redis.Cmdable, opts ...RedisStreamOption) *RedisStreamDriver {
+	rsd := &RedisStreamDriver{
+		redisStats: redisStats{r},
+		group:      defaultStreamGroup,
+		consumer:   uuid.New().String(),
+		claimIdle:  defaultStreamIdleFor,
+	}
+
+	for _, opt := range opts {
+		opt(rsd)
+	}
+
+	return rsd
+}
+
+// RedisStreamDriver is a queue driver backed by redis streams and consumer groups,
+// every read message stays in the consumer's pending list until it is acked
+type RedisStreamDriver struct {
+	redisStats
+
+	group     string
+	consumer  string
+	claimIdle time.Duration
+
+	groups   sync.Map
+	inFlight sync.Map
+}
+
+// Write appends a message to the queue stream
+func (rsd *RedisStreamDriver) Write(ctx context.Context, queue string, d []byte) error {
+	r, err := rsd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return redisStreamWriteScript.Run(r, rsd.writeKeys(queue), streamField, d, messageID(d)).Err()
+}
+
+// WriteBatch appends many messages to the queue stream in a single pipelined round trip
+func (rsd *RedisStreamDriver) WriteBatch(ctx context.Context, queue string, ds [][]byte) []error {
+	r, err := rsd.conn(ctx)
+
+	if err != nil {
+		return batchErrors(len(ds), err)
+	}
+
+	// the script is loaded first so pipelined calls can run it by its hash
+	if err := redisStreamWriteScript.Load(r).Err(); err != nil {
+		return batchErrors(len(ds), err)
+	}
+
+	cmds, _ := r.Pipelined(func(p redis.Pipeliner) error {
+		for _, d := range ds {
+			redisStreamWriteScript.EvalSha(p, rsd.writeKeys(queue), streamField, d, messageID(d))
+		}
+
+		return nil
+	})
+
+	return cmdErrors(cmds)
+}
+
+// Read returns a message abandoned by a dead consumer if there is one,
+// otherwise the next message never delivered to the group
+func (rsd *RedisStreamDriver) Read(ctx context.Context, queue string) ([]byte, error) {
+	return rsd.read(ctx, queue, -1)
+}
+
+// ReadBlocking is Read waiting up to timeout for a message to be written
+func (rsd *RedisStreamDriver) ReadBlocking(ctx context.Context, queue string, timeout time.Duration) ([]byte, error) {
+	return rsd.read(ctx, queue, blockFor(ctx, timeout, time.Millisecond))
+}
+
+// Ack acknowledges a message and removes it from the stream
+func (rsd *RedisStreamDriver) Ack(ctx context.Context, queue string, d []byte) error {
+	r, err := rsd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	stream := rsd.streamKey(queue)
+
+	id, err := rsd.takeInFlight(stream, d)
+
+	if err != nil {
+		return err
+	}
+
+	keys := []string{stream, idsKey(queue), entriesKey(queue)}
+
+	return redisStreamAckScript.Run(r, keys, rsd.group, id, messageID(d), d).Err()
+}
+
+// Nack acknowledges a message and appends it to the stream again
+func (rsd *RedisStreamDriver) Nack(ctx context.Context, queue string, d []byte) error {
+	r, err := rsd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	stream := rsd.streamKey(queue)
+
+	id, err := rsd.takeInFlight(stream, d)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = r.TxPipelined(func(p redis.Pipeliner) error {
+		p.XAck(stream, rsd.group, id)
+		p.XDel(stream, id)
+		redisStreamWriteScript.Eval(p, rsd.writeKeys(queue), streamField, d, messageID(d))
+
+		return nil
+	})
+
+	return err
+}
+
+// Schedule holds a message back until at
+func (rsd *RedisStreamDriver) Schedule(ctx context.Context, queue string, d []byte, at time.Time) error {
+	r, err := rsd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	return schedule(r, queue, d, at)
+}
+
+// Promote appends messages scheduled until a given time to the stream
+func (rsd *RedisStreamDriver) Promote(ctx context.Context, queue string, until time.Time) (int64, error) {
+	r, err := rsd.conn(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	keys := []string{scheduledKey(queue), rsd.streamKey(queue), entriesKey(queue)}
+
+	return redisStreamPromoteScript.Run(r, keys, unixMilli(until), streamField).Int64()
+}
+
+// Reschedule moves a scheduled or undelivered message to be executed at a given time
+func (rsd *RedisStreamDriver) Reschedule(ctx context.Context, queue string, id string, at time.Time) error {
+	_, err := rsd.reschedule(ctx, queue, id, unixMilli(at))
+
+	return err
+}
+
+// Delete removes a scheduled or undelivered message and returns it
+func (rsd *RedisStreamDriver) Delete(ctx context.Context, queue string, id string) ([]byte, error) {
+	return rsd.reschedule(ctx, queue, id, "")
+}
+
+// Register registers a new queue (should not be additive)
+func (rsd *RedisStreamDriver) Register(ctx context.Context, queue string) error {
+	return rsd.register(ctx, queue)
+}
+
+// reschedule returns the message it deleted or rescheduled
+func (rsd *RedisStreamDriver) reschedule(ctx context.Context, queue string, id string, score interface{}) ([]byte, error) {
+	r, err := rsd.conn(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{scheduledKey(queue), rsd.streamKey(queue), idsKey(queue), entriesKey(queue)}
+
+	d, err := redisStreamRescheduleScript.Run(r, keys, id, rsd.group, score).String()
+
+	if err == redis.Nil {
+		return nil, ErrMessageNotFound
+	}
+
+	return []byte(d), err
+}
+
+func (rsd *RedisStreamDriver) writeKeys(queue string) []string {
+	return []string{rsd.streamKey(queue), idsKey(queue), entriesKey(queue)}
+}
+
+func (rsd *RedisStreamDriver) read(ctx context.Context, queue string, block time.Duration) ([]byte, error) {
+	stream := rsd.streamKey(queue)
+
+	if err := rsd.ensureGroup(ctx, stream); err != nil {
+		return nil, err
+	}
+
+	id, d, err := rsd.claim(ctx, stream)
+
+	if err == redis.Nil {
+		id, d, err = rsd.readNew(ctx, stream, block)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rsd.inFlight.Store(rsd.inFlightKey(stream, d), id)
+
+	return d, nil
+}
+
+func (rsd *RedisStreamDriver) claim(ctx context.Context, stream string) (string, []byte, error) {
+	r, err := rsd.conn(ctx)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	v, err := redisClaimScript.Run(
+		r,
+		[]string{stream},
+		rsd.group,
+		rsd.consumer,
+		rsd.claimIdle.Milliseconds(),
+		streamField,
+	).Result()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	e, ok := v.([]interface{})
+
+	if !ok || len(e) != 2 {
+		return "", nil, fmt.Errorf("unexpected claim reply %v", v)
+	}
+
+	id, _ := e[0].(string)
+	d, _ := e[1].(string)
+
+	return id, []byte(d), nil
+}
+
+func (rsd *RedisStreamDriver) readNew(ctx context.Context, stream string, block time.Duration) (string, []byte, error) {
+	r, err := rsd.conn(ctx)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	streams, err := r.XReadGroup(&redis.XReadGroupArgs{
+		Group:    rsd.group,
+		Consumer: rsd.consumer,
+		Streams:  []string{stream, ">"},
+		Count:    1,
+		Block:    block,
+	}).Result()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, s := range streams {
+		for _, m := range s.Messages {
+			d, _ := m.Values[streamField].(string)
+
+			return m.ID, []byte(d), nil
+		}
+	}
+
+	return "", nil, redis.Nil
+}
+
+func (rsd *RedisStreamDriver) ensureGroup(ctx context.Context, stream string) error {
+	r, err := rsd.conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := rsd.groups.Load(stream); ok {
+		return nil
+	}
+
+	if err := r.XGroupCreateMkStream(stream, rsd.group, "0").Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	rsd.groups.Store(stream, struct{}{})
+
+	return nil
+}
+
+func (rsd *RedisStreamDriver) takeInFlight(stream string, d []byte) (string, error) {
+	id, ok := rsd.inFlight.LoadAndDelete(rsd.inFlightKey(stream, d))
+
+	if !ok {
+		return "", fmt.Errorf("message is not in flight on %s", stream)
+	}
+
+	return id.(string), nil
+}
+
+func (rsd *RedisStreamDriver) inFlightKey(stream string, d []byte) string {
+	return stream + "\x00" + string(d)
+}
+
+// entriesKey is the hash of stream entry IDs of messages by their ID
+func entriesKey(queue string) string {
+	return fmt.Sprintf("%s:entries", queue)
+}
+
+func (rsd *RedisStreamDriver) streamKey(queue string) string {
+	return fmt.Sprintf("%s:stream", queue)
+}
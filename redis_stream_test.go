@@ -0,0 +1,226 @@
+package simpleq
+
+import (
+	"context"
+	"github.com/go-redis/redis"
+	"testing"
+	"time"
+)
+
+func TestRedisStreamDriver_Read(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisStreamDriver(r, WithStreamConsumer("test-consumer"))
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_nil_error_when_queue_is_empty", func(t *testing.T) {
+		if _, err := d.Read(context.Background(), queue); err != redis.Nil {
+			t.Errorf("Expected Read() to return %v, got %v", redis.Nil, err)
+		}
+	})
+
+	t.Run("it_should_read_messages_in_order", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte("a"))
+		_ = d.Write(context.Background(), queue, []byte("b"))
+
+		for _, expect := range []string{"a", "b"} {
+			if got, err := d.Read(context.Background(), queue); err != nil || string(got) != expect {
+				t.Errorf("Expected Read() to return %s, got %s, %v", expect, got, err)
+			}
+		}
+	})
+
+	t.Run("it_should_keep_read_messages_pending", func(t *testing.T) {
+		if got := r.XPending(d.streamKey(queue), defaultStreamGroup).Val(); got.Count != 2 {
+			t.Errorf("Expected 2 pending messages, got %v", got.Count)
+		}
+	})
+}
+
+func TestRedisStreamDriver_ReadBlocking(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisStreamDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_nil_error_once_timeout_passes", func(t *testing.T) {
+		if _, err := d.ReadBlocking(context.Background(), queue, 10*time.Millisecond); err != redis.Nil {
+			t.Errorf("Expected ReadBlocking() to return %v, got %v", redis.Nil, err)
+		}
+	})
+
+	t.Run("it_should_wait_for_message_to_be_written", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_ = d.Write(context.Background(), queue, []byte("test-data"))
+		}()
+
+		if got, err := d.ReadBlocking(context.Background(), queue, time.Second); err != nil || string(got) != "test-data" {
+			t.Errorf("Expected ReadBlocking() to return test-data, got %s, %v", got, err)
+		}
+	})
+}
+
+func TestRedisStreamDriver_WriteBatch(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisStreamDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_append_every_message_in_order", func(t *testing.T) {
+		_ = d.WriteBatch(context.Background(), queue, [][]byte{[]byte("a"), []byte("b")})
+
+		for _, expect := range []string{"a", "b"} {
+			if got, err := d.Read(context.Background(), queue); err != nil || string(got) != expect {
+				t.Errorf("Expected Read() to return %s, got %s, %v", expect, got, err)
+			}
+		}
+	})
+}
+
+func TestRedisStreamDriver_Read_claim(t *testing.T) {
+	_, r := newTestRedis(t)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_claim_messages_abandoned_by_another_consumer", func(t *testing.T) {
+		dead := NewRedisStreamDriver(r, WithStreamConsumer("dead-consumer"))
+		alive := NewRedisStreamDriver(r, WithStreamConsumer("alive-consumer"), WithStreamClaimIdle(time.Millisecond))
+
+		_ = dead.Write(context.Background(), queue, []byte("test-data"))
+		_, _ = dead.Read(context.Background(), queue)
+
+		time.Sleep(5 * time.Millisecond)
+
+		if got, err := alive.Read(context.Background(), queue); err != nil || string(got) != "test-data" {
+			t.Errorf("Expected Read() to claim test-data, got %s, %v", got, err)
+		}
+	})
+}
+
+func TestRedisStreamDriver_Ack(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisStreamDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_remove_message_from_stream", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte("test-data"))
+		m, _ := d.Read(context.Background(), queue)
+
+		if err := d.Ack(context.Background(), queue, m); err != nil {
+			t.Errorf("Expected Ack() not to return error, got %v", err)
+		}
+
+		if got := r.XLen(d.streamKey(queue)).Val(); got != 0 {
+			t.Errorf("Expected stream to be empty, got %v entries", got)
+		}
+	})
+
+	t.Run("it_should_return_error_when_message_is_not_in_flight", func(t *testing.T) {
+		if err := d.Ack(context.Background(), queue, []byte("unknown")); err == nil {
+			t.Errorf("Expected Ack() to return error")
+		}
+	})
+}
+
+func TestRedisStreamDriver_Nack(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisStreamDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_message_to_queue", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte("test-data"))
+		m, _ := d.Read(context.Background(), queue)
+
+		if err := d.Nack(context.Background(), queue, m); err != nil {
+			t.Errorf("Expected Nack() not to return error, got %v", err)
+		}
+
+		if got, err := d.Read(context.Background(), queue); err != nil || string(got) != "test-data" {
+			t.Errorf("Expected Read() to return test-data, got %s, %v", got, err)
+		}
+	})
+}
+
+func TestRedisStreamDriver_Promote(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisStreamDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+	now := time.Now()
+
+	t.Run("it_should_append_due_messages_to_stream", func(t *testing.T) {
+		_ = d.Schedule(context.Background(), queue, []byte("due"), now.Add(-time.Second))
+		_ = d.Schedule(context.Background(), queue, []byte("later"), now.Add(time.Hour))
+
+		if n, err := d.Promote(context.Background(), queue, now); err != nil || n != 1 {
+			t.Errorf("Expected Promote() to promote 1 message, got %v, %v", n, err)
+		}
+
+		if got, _ := d.Read(context.Background(), queue); string(got) != "due" {
+			t.Errorf("Expected Read() to return due, got %s", got)
+		}
+	})
+}
+
+func TestRedisStreamDriver_Delete(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisStreamDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_delete_undelivered_message", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte(`{"id":"pending"}`))
+
+		if _, err := d.Delete(context.Background(), queue, "pending"); err != nil {
+			t.Errorf("Expected Delete() not to return error, got %v", err)
+		}
+
+		if _, err := d.Read(context.Background(), queue); err != redis.Nil {
+			t.Errorf("Expected Read() to return %v, got %v", redis.Nil, err)
+		}
+	})
+
+	t.Run("it_should_return_error_when_message_has_been_delivered", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte(`{"id":"delivered"}`))
+		_, _ = d.Read(context.Background(), queue)
+
+		if _, err := d.Delete(context.Background(), queue, "delivered"); err != ErrMessageNotFound {
+			t.Errorf("Expected Delete() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+	})
+
+	t.Run("it_should_delete_promoted_message", func(t *testing.T) {
+		_ = d.Schedule(context.Background(), queue, []byte(`{"id":"promoted"}`), time.Now())
+		_, _ = d.Promote(context.Background(), queue, time.Now())
+
+		if _, err := d.Delete(context.Background(), queue, "promoted"); err != nil {
+			t.Errorf("Expected Delete() not to return error, got %v", err)
+		}
+	})
+
+	t.Run("it_should_forget_acked_message", func(t *testing.T) {
+		queue := "simple-queue:data:active:acked-queue"
+		_ = d.Write(context.Background(), queue, []byte(`{"id":"acked"}`))
+		m, _ := d.Read(context.Background(), queue)
+		_ = d.Ack(context.Background(), queue, m)
+
+		if got := r.HLen(idsKey(queue)).Val() + r.HLen(entriesKey(queue)).Val(); got != 0 {
+			t.Errorf("Expected acked message not to be indexed, got %v entries", got)
+		}
+	})
+
+}
+
+func TestRedisStreamDriver_Reschedule(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisStreamDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+	now := time.Now()
+
+	t.Run("it_should_reschedule_undelivered_message", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte(`{"id":"pending"}`))
+
+		if err := d.Reschedule(context.Background(), queue, "pending", now.Add(time.Hour)); err != nil {
+			t.Errorf("Expected Reschedule() not to return error, got %v", err)
+		}
+
+		if n, _ := d.Promote(context.Background(), queue, now.Add(time.Hour)); n != 1 {
+			t.Errorf("Expected rescheduled message to be promoted")
+		}
+	})
+}
@@ -0,0 +1,899 @@
+package simpleq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	s := miniredis.RunT(t)
+	r := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	t.Cleanup(func() {
+		_ = r.Close()
+	})
+
+	return s, r
+}
+
+func TestRedisQueueDriver_Read(t *testing.T) {
+	s, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r, WithRedisConsumer("test-consumer"))
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_nil_error_when_queue_is_empty", func(t *testing.T) {
+		if _, err := d.Read(context.Background(), queue); err != redis.Nil {
+			t.Errorf("Expected Read() to return %v, got %v", redis.Nil, err)
+		}
+	})
+
+	t.Run("it_should_move_message_in_flight", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte("test-data"))
+
+		got, err := d.Read(context.Background(), queue)
+
+		if err != nil || string(got) != "test-data" {
+			t.Errorf("Expected Read() to return test-data, got %s, %v", got, err)
+		}
+
+		if got, _ := s.List(queue + ":in-flight:test-consumer"); !reflect.DeepEqual(got, []string{"test-data"}) {
+			t.Errorf("Expected in-flight list to contain test-data, got %v", got)
+		}
+	})
+}
+
+func TestRedisQueueDriver_context(t *testing.T) {
+	s, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_error_when_context_is_done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := d.Write(ctx, queue, []byte("test-data")); err != context.Canceled {
+			t.Errorf("Expected Write() to return error %v, got %v", context.Canceled, err)
+		}
+
+		if s.Exists(queue + ":active") {
+			t.Errorf("Expected message not to be written")
+		}
+	})
+}
+
+func TestRedisQueueDriver_ReadBlocking(t *testing.T) {
+	_, r := newTestRedis(t)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_not_block_in_set_mode", func(t *testing.T) {
+		if _, err := NewRedisQueueDriver(r).ReadBlocking(context.Background(), queue, time.Second); err != ErrNotSupported {
+			t.Errorf("Expected ReadBlocking() to return error %v, got %v", ErrNotSupported, err)
+		}
+	})
+
+	t.Run("it_should_wait_for_message_in_list_mode", func(t *testing.T) {
+		d := NewRedisQueueDriver(r, WithRedisMode(RedisModeList), WithRedisDedup())
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_ = d.Write(context.Background(), queue, []byte("test-data"))
+		}()
+
+		if got, err := d.ReadBlocking(context.Background(), queue, time.Second); err != nil || string(got) != "test-data" {
+			t.Errorf("Expected ReadBlocking() to return test-data, got %s, %v", got, err)
+		}
+
+		if n := r.SCard(queue + ":list:members").Val(); n != 0 {
+			t.Errorf("Expected read message to leave dedup members, got %v", n)
+		}
+	})
+
+	t.Run("it_should_return_nil_error_once_timeout_passes", func(t *testing.T) {
+		d := NewRedisQueueDriver(r, WithRedisMode(RedisModeList))
+
+		if _, err := d.ReadBlocking(context.Background(), queue, time.Second); err != redis.Nil {
+			t.Errorf("Expected ReadBlocking() to return %v, got %v", redis.Nil, err)
+		}
+	})
+}
+
+func TestRedisQueueDriver_ReadFirst(t *testing.T) {
+	_, r := newTestRedis(t)
+	queues := []string{"simple-queue:data:active:test-queue:priority:1", "simple-queue:data:active:test-queue"}
+
+	for _, mode := range []RedisMode{RedisModeSet, RedisModeList} {
+		d := NewRedisQueueDriver(r, WithRedisMode(mode))
+
+		t.Run("it_should_read_from_first_non_empty_queue", func(t *testing.T) {
+			_ = d.Write(context.Background(), queues[1], []byte("low"))
+			_ = d.Write(context.Background(), queues[0], []byte("high"))
+
+			for i, expect := range []string{"high", "low"} {
+				if n, got, err := d.ReadFirst(context.Background(), queues); err != nil || n != i || string(got) != expect {
+					t.Errorf("Expected ReadFirst() to return %v, %s, got %v, %s, %v", i, expect, n, got, err)
+				}
+
+				_ = d.Ack(context.Background(), queues[i], []byte(expect))
+			}
+		})
+
+		t.Run("it_should_return_nil_error_when_every_queue_is_empty", func(t *testing.T) {
+			if _, _, err := d.ReadFirst(context.Background(), queues); err != redis.Nil {
+				t.Errorf("Expected ReadFirst() to return %v, got %v", redis.Nil, err)
+			}
+		})
+	}
+}
+
+func TestRedisQueueDriver_WriteBatch(t *testing.T) {
+	_, r := newTestRedis(t)
+	queue := "simple-queue:data:active:test-queue"
+	batch := [][]byte{[]byte("a"), []byte("b"), []byte("a")}
+
+	t.Run("it_should_write_batch_in_set_mode", func(t *testing.T) {
+		d := NewRedisQueueDriver(r)
+
+		if errs := d.WriteBatch(context.Background(), queue, batch); !reflect.DeepEqual(errs, []error{nil, nil, nil}) {
+			t.Errorf("Expected WriteBatch() not to return errors, got %v", errs)
+		}
+
+		if n := r.SCard(queue + ":active").Val(); n != 2 {
+			t.Errorf("Expected 2 distinct messages, got %v", n)
+		}
+	})
+
+	t.Run("it_should_write_batch_in_list_mode", func(t *testing.T) {
+		d := NewRedisQueueDriver(r, WithRedisMode(RedisModeList))
+		_ = d.WriteBatch(context.Background(), queue, batch)
+
+		for _, expect := range []string{"a", "b", "a"} {
+			if got, _ := d.Read(context.Background(), queue); string(got) != expect {
+				t.Errorf("Expected Read() to return %s, got %s", expect, got)
+			}
+		}
+	})
+
+	t.Run("it_should_deduplicate_batch_with_dedup", func(t *testing.T) {
+		r.FlushAll()
+		d := NewRedisQueueDriver(r, WithRedisMode(RedisModeList), WithRedisDedup())
+		_ = d.WriteBatch(context.Background(), queue, batch)
+
+		if n := r.LLen(queue + ":list").Val(); n != 2 {
+			t.Errorf("Expected 2 distinct messages, got %v", n)
+		}
+	})
+
+	t.Run("it_should_return_error_for_every_message_when_context_is_done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		errs := NewRedisQueueDriver(r).WriteBatch(ctx, queue, batch)
+
+		if len(errs) != 3 || errs[2] != context.Canceled {
+			t.Errorf("Expected WriteBatch() to return %v for every message, got %v", context.Canceled, errs)
+		}
+	})
+}
+
+func TestRedisQueueDriver_Ack(t *testing.T) {
+	s, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r, WithRedisConsumer("test-consumer"))
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_remove_message_from_in_flight_list", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte("test-data"))
+		m, _ := d.Read(context.Background(), queue)
+
+		if err := d.Ack(context.Background(), queue, m); err != nil {
+			t.Errorf("Expected Ack() not to return error, got %v", err)
+		}
+
+		if s.Exists(queue + ":in-flight:test-consumer") {
+			t.Errorf("Expected in-flight list to be empty")
+		}
+	})
+}
+
+func TestRedisQueueDriver_Nack(t *testing.T) {
+	s, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r, WithRedisConsumer("test-consumer"))
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_message_to_queue", func(t *testing.T) {
+		_ = d.Write(context.Background(), queue, []byte("test-data"))
+		m, _ := d.Read(context.Background(), queue)
+
+		if err := d.Nack(context.Background(), queue, m); err != nil {
+			t.Errorf("Expected Nack() not to return error, got %v", err)
+		}
+
+		if s.Exists(queue + ":in-flight:test-consumer") {
+			t.Errorf("Expected in-flight list to be empty")
+		}
+
+		if got, _ := d.Read(context.Background(), queue); string(got) != "test-data" {
+			t.Errorf("Expected Read() to return test-data, got %s", got)
+		}
+	})
+}
+
+func TestRedisQueueDriver_Register(t *testing.T) {
+	_, r := newTestRedis(t)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_recover_messages_left_in_flight", func(t *testing.T) {
+		crashed := NewRedisQueueDriver(r, WithRedisConsumer("test-consumer"))
+		_ = crashed.Write(context.Background(), queue, []byte("test-data"))
+		_, _ = crashed.Read(context.Background(), queue)
+
+		restarted := NewRedisQueueDriver(r, WithRedisConsumer("test-consumer"))
+
+		if err := restarted.Register(context.Background(), "test-queue"); err != nil {
+			t.Errorf("Expected Register() not to return error, got %v", err)
+		}
+
+		if got, _ := restarted.Read(context.Background(), queue); string(got) != "test-data" {
+			t.Errorf("Expected Read() to return test-data, got %s", got)
+		}
+	})
+
+	t.Run("it_should_recover_messages_left_in_flight_by_priority_levels", func(t *testing.T) {
+		level := queue + ":priority:5"
+		crashed := NewRedisQueueDriver(r, WithRedisConsumer("test-consumer"))
+		_ = crashed.Write(context.Background(), level, []byte("test-data"))
+		_, _ = crashed.Read(context.Background(), level)
+
+		if got := r.SMembers(levelsKey(queue)).Val(); !reflect.DeepEqual(got, []string{level}) {
+			t.Errorf("Expected written priority level to be recorded, got %v", got)
+		}
+
+		restarted := NewRedisQueueDriver(r, WithRedisConsumer("test-consumer"))
+		_ = restarted.Register(context.Background(), "test-queue")
+
+		if got, _ := restarted.Read(context.Background(), level); string(got) != "test-data" {
+			t.Errorf("Expected Read() to return test-data, got %s", got)
+		}
+	})
+}
+
+func TestRedisQueueDriver_RecoverInFlight(t *testing.T) {
+	_, r := newTestRedis(t)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_return_dead_consumer_messages_to_queue", func(t *testing.T) {
+		dead := NewRedisQueueDriver(r, WithRedisConsumer("dead-consumer"))
+		_ = dead.Write(context.Background(), queue, []byte("a"))
+		_ = dead.Write(context.Background(), queue, []byte("b"))
+		_, _ = dead.Read(context.Background(), queue)
+		_, _ = dead.Read(context.Background(), queue)
+
+		alive := NewRedisQueueDriver(r)
+
+		if n, err := alive.RecoverInFlight(context.Background(), queue, "dead-consumer"); err != nil || n != 2 {
+			t.Errorf("Expected RecoverInFlight() to recover 2 messages, got %v, %v", n, err)
+		}
+	})
+
+	t.Run("it_should_return_tenant_messages_to_their_tenant", func(t *testing.T) {
+		for _, mode := range []RedisMode{RedisModeSet, RedisModeList} {
+			dead := NewRedisQueueDriver(r, WithRedisConsumer("dead-consumer"), WithRedisMode(mode))
+			m := []byte(`{"id":"tenanted","tenant_key":"a"}`)
+			_ = dead.WriteTenant(context.Background(), queue, "a", m)
+			_, _, _ = dead.ReadTenant(context.Background(), queue, nil)
+
+			alive := NewRedisQueueDriver(r, WithRedisMode(mode))
+
+			if n, err := alive.RecoverInFlight(context.Background(), queue, "dead-consumer"); err != nil || n != 1 {
+				t.Errorf("Expected RecoverInFlight() to recover 1 message, got %v, %v", n, err)
+			}
+
+			if backlog := r.HGet(tenantsKey(queue), "a").Val(); backlog != "1" {
+				t.Errorf("Expected backlog of tenant a to be restored, got %v", backlog)
+			}
+
+			if tenant, got, err := alive.ReadTenant(context.Background(), queue, nil); err != nil || tenant != "a" || string(got) != string(m) {
+				t.Errorf("Expected ReadTenant() to return recovered message of tenant a, got %s:%s, %v", tenant, got, err)
+			}
+		}
+	})
+}
+
+func TestRedisQueueDriver_Reap(t *testing.T) {
+	_, r := newTestRedis(t)
+	queue := "simple-queue:data:active:test-queue"
+	ctx := context.Background()
+
+	dead := NewRedisQueueDriver(r, WithRedisConsumer("dead-consumer"))
+	_ = dead.Heartbeat(ctx, queue, 50*time.Millisecond)
+	_ = dead.Write(ctx, queue, []byte("test-data"))
+	_, _ = dead.Read(ctx, queue)
+
+	alive := NewRedisQueueDriver(r, WithRedisConsumer("alive-consumer"))
+	_ = alive.Heartbeat(ctx, queue, time.Hour)
+
+	t.Run("it_should_not_reap_consumers_with_a_heartbeat", func(t *testing.T) {
+		if n, err := NewRedisQueueDriver(r).Reap(ctx, queue); err != nil || n != 0 {
+			t.Errorf("Expected Reap() to reap no messages, got %v, %v", n, err)
+		}
+	})
+
+	t.Run("it_should_return_messages_of_dead_consumers_to_queue", func(t *testing.T) {
+		time.Sleep(60 * time.Millisecond)
+
+		if n, err := alive.Reap(ctx, queue); err != nil || n != 1 {
+			t.Errorf("Expected Reap() to reap 1 message, got %v, %v", n, err)
+		}
+
+		if got, _ := alive.Read(ctx, queue); string(got) != "test-data" {
+			t.Errorf("Expected Read() to return test-data, got %s", got)
+		}
+
+		if n, _ := alive.Reap(ctx, queue); n != 0 {
+			t.Errorf("Expected Reap() to forget reaped consumer, got %v", n)
+		}
+	})
+}
+
+func TestRedisQueueDriver_Claim(t *testing.T) {
+	mr, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r)
+	queue := "simple-queue:data:test-queue"
+
+	t.Run("it_should_claim_key_once_within_window", func(t *testing.T) {
+		for _, expect := range []bool{true, false} {
+			if got, err := d.Claim(context.Background(), queue, "test-key", time.Hour); err != nil || got != expect {
+				t.Errorf("Expected Claim() to return %v, got %v, %v", expect, got, err)
+			}
+		}
+	})
+
+	t.Run("it_should_claim_released_key_again", func(t *testing.T) {
+		_ = d.Release(context.Background(), queue, "test-key")
+
+		if got, _ := d.Claim(context.Background(), queue, "test-key", time.Hour); !got {
+			t.Errorf("Expected Claim() to claim released key")
+		}
+	})
+
+	t.Run("it_should_claim_key_again_once_window_passes", func(t *testing.T) {
+		mr.FastForward(time.Hour)
+
+		if got, _ := d.Claim(context.Background(), queue, "test-key", time.Hour); !got {
+			t.Errorf("Expected Claim() to claim expired key")
+		}
+	})
+}
+
+func TestRedisQueueDriver_Lock(t *testing.T) {
+	mr, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r)
+	queue := "simple-queue:data:test-queue"
+
+	t.Run("it_should_lock_key_for_a_single_owner", func(t *testing.T) {
+		for _, owner := range []string{"a", "b", "a"} {
+			expect := owner == "a"
+
+			if got, err := d.Lock(context.Background(), queue, "test-key", owner, time.Hour); err != nil || got != expect {
+				t.Errorf("Expected Lock() by %s to return %v, got %v, %v", owner, expect, got, err)
+			}
+		}
+	})
+
+	t.Run("it_should_only_unlock_for_owner", func(t *testing.T) {
+		_ = d.Unlock(context.Background(), queue, "test-key", "b")
+
+		if got, _ := d.Lock(context.Background(), queue, "test-key", "b", time.Hour); got {
+			t.Errorf("Expected Unlock() by another owner to keep the lock")
+		}
+
+		_ = d.Unlock(context.Background(), queue, "test-key", "a")
+
+		if got, _ := d.Lock(context.Background(), queue, "test-key", "b", time.Hour); !got {
+			t.Errorf("Expected Lock() to lock released key")
+		}
+	})
+
+	t.Run("it_should_lock_key_again_once_ttl_passes", func(t *testing.T) {
+		mr.FastForward(time.Hour)
+
+		if got, _ := d.Lock(context.Background(), queue, "test-key", "a", time.Hour); !got {
+			t.Errorf("Expected Lock() to lock expired key")
+		}
+	})
+}
+
+func TestRedisQueueDriver_Take(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r)
+	queue := "simple-queue:data:test-queue"
+
+	t.Run("it_should_take_burst_tokens_then_wait", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if wait, err := d.Take(context.Background(), queue, 10, 2); err != nil || wait != 0 {
+				t.Errorf("Expected Take() to take a token, got %v, %v", wait, err)
+			}
+		}
+
+		if wait, err := d.Take(context.Background(), queue, 10, 2); err != nil || wait <= 0 || wait > 100*time.Millisecond {
+			t.Errorf("Expected Take() to wait up to 100ms, got %v, %v", wait, err)
+		}
+	})
+
+	t.Run("it_should_refill_tokens_over_time", func(t *testing.T) {
+		time.Sleep(150 * time.Millisecond)
+
+		if wait, err := d.Take(context.Background(), queue, 10, 2); err != nil || wait != 0 {
+			t.Errorf("Expected Take() to take a refilled token, got %v, %v", wait, err)
+		}
+	})
+}
+
+func TestRedisQueueDriver_AcquireSlot(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r)
+	queue := "simple-queue:data:test-queue"
+
+	t.Run("it_should_hand_out_up_to_limit_slots", func(t *testing.T) {
+		for _, holder := range []string{"a", "b", "c", "a"} {
+			expect := holder != "c"
+
+			if got, err := d.AcquireSlot(context.Background(), queue, holder, 2, time.Hour); err != nil || got != expect {
+				t.Errorf("Expected AcquireSlot() by %s to return %v, got %v, %v", holder, expect, got, err)
+			}
+		}
+	})
+
+	t.Run("it_should_hand_out_released_slot", func(t *testing.T) {
+		_ = d.ReleaseSlot(context.Background(), queue, "a")
+
+		if got, _ := d.AcquireSlot(context.Background(), queue, "c", 2, time.Hour); !got {
+			t.Errorf("Expected AcquireSlot() to take released slot")
+		}
+	})
+
+	t.Run("it_should_hand_out_slot_once_lease_expires", func(t *testing.T) {
+		_ = d.ReleaseSlot(context.Background(), queue, "b")
+		_, _ = d.AcquireSlot(context.Background(), queue, "b", 2, time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+
+		if got, _ := d.AcquireSlot(context.Background(), queue, "d", 2, time.Hour); !got {
+			t.Errorf("Expected AcquireSlot() to take expired slot")
+		}
+	})
+}
+
+func TestRedisQueueDriver_groups(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+	ctx := context.Background()
+
+	for _, m := range []string{"a1", "a2"} {
+		_ = d.WriteGroup(ctx, queue, "a", []byte(m))
+	}
+
+	_ = d.WriteGroup(ctx, queue, "b", []byte("b1"))
+
+	t.Run("it_should_read_groups_round_robin_first_in_first_out", func(t *testing.T) {
+		for _, expect := range []string{"a:a1", "b:b1"} {
+			if g, m, err := d.ReadGroup(ctx, queue, time.Hour); err != nil || g+":"+string(m) != expect {
+				t.Errorf("Expected ReadGroup() to return %s, got %s:%s, %v", expect, g, m, err)
+			}
+		}
+	})
+
+	t.Run("it_should_not_read_locked_groups", func(t *testing.T) {
+		if g, m, err := d.ReadGroup(ctx, queue, time.Hour); err != redis.Nil {
+			t.Errorf("Expected ReadGroup() to return redis.Nil, got %s:%s, %v", g, m, err)
+		}
+	})
+
+	t.Run("it_should_unlock_acknowledged_group", func(t *testing.T) {
+		_ = d.AckGroup(ctx, queue, "a", []byte("a1"))
+
+		if g, m, err := d.ReadGroup(ctx, queue, time.Hour); err != nil || g != "a" || string(m) != "a2" {
+			t.Errorf("Expected ReadGroup() to return a:a2, got %s:%s, %v", g, m, err)
+		}
+	})
+
+	t.Run("it_should_read_nacked_message_first_once_its_delay_passes", func(t *testing.T) {
+		_ = d.WriteGroup(ctx, queue, "a", []byte("a3"))
+		_ = d.NackGroup(ctx, queue, "a", []byte("a2"), []byte("a2-retry"), time.Now().Add(5*time.Millisecond))
+
+		if _, _, err := d.ReadGroup(ctx, queue, time.Hour); err != redis.Nil {
+			t.Errorf("Expected ReadGroup() to keep group locked, got %v", err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		if g, m, err := d.ReadGroup(ctx, queue, time.Millisecond); err != nil || g != "a" || string(m) != "a2-retry" {
+			t.Errorf("Expected ReadGroup() to return a:a2-retry, got %s:%s, %v", g, m, err)
+		}
+	})
+
+	t.Run("it_should_read_message_again_once_its_lease_expires", func(t *testing.T) {
+		time.Sleep(5 * time.Millisecond)
+
+		if g, m, err := d.ReadGroup(ctx, queue, time.Hour); err != nil || g != "a" || string(m) != "a2-retry" {
+			t.Errorf("Expected ReadGroup() to return a:a2-retry, got %s:%s, %v", g, m, err)
+		}
+	})
+
+	t.Run("it_should_renew_lease_of_in_flight_message_only", func(t *testing.T) {
+		if renewed, err := d.RenewGroup(ctx, queue, "a", []byte("a3"), time.Hour); err != nil || renewed {
+			t.Errorf("Expected RenewGroup() not to renew lease for a message which is not in flight, got %v, %v", renewed, err)
+		}
+
+		if renewed, err := d.RenewGroup(ctx, queue, "a", []byte("a2-retry"), 5*time.Millisecond); err != nil || !renewed {
+			t.Errorf("Expected RenewGroup() to renew lease, got %v, %v", renewed, err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		if g, m, err := d.ReadGroup(ctx, queue, time.Hour); err != nil || g != "a" || string(m) != "a2-retry" {
+			t.Errorf("Expected ReadGroup() to return a:a2-retry once renewed lease expired, got %s:%s, %v", g, m, err)
+		}
+	})
+}
+
+func TestRedisQueueDriver_tenants(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+	ctx := context.Background()
+	_ = d.Register(ctx, "test-queue")
+
+	for _, m := range []string{"a1", "a2", "a3", "a4"} {
+		_ = d.WriteTenant(ctx, queue, "a", []byte(m))
+	}
+
+	for _, m := range []string{"b1", "b2"} {
+		_ = d.WriteTenant(ctx, queue, "b", []byte(m))
+	}
+
+	_ = d.WriteTenant(ctx, queue+":priority:5", "a", []byte("a5"))
+
+	t.Run("it_should_count_backlogs_of_tenants", func(t *testing.T) {
+		expect := map[string]int64{"a": 5, "b": 2}
+
+		if got, err := d.GetStats(ctx); err != nil || !reflect.DeepEqual((*got)["test-queue"].TenantBacklogs, expect) {
+			t.Errorf("Expected GetStats() to return backlogs %v, got %v, %v", expect, got, err)
+		}
+	})
+
+	t.Run("it_should_read_tenants_round_robin_by_weight", func(t *testing.T) {
+		for _, expect := range []string{"a:a1", "a:a2", "b:b1", "a:a3", "a:a4", "b:b2"} {
+			if tenant, m, err := d.ReadTenant(ctx, queue, map[string]int{"a": 2}); err != nil || tenant+":"+string(m) != expect {
+				t.Errorf("Expected ReadTenant() to return %s, got %s:%s, %v", expect, tenant, m, err)
+			}
+		}
+
+		if tenant, m, err := d.ReadTenant(ctx, queue, nil); err != redis.Nil {
+			t.Errorf("Expected ReadTenant() to return redis.Nil, got %s:%s, %v", tenant, m, err)
+		}
+	})
+
+	t.Run("it_should_read_nacked_message_again", func(t *testing.T) {
+		_ = d.NackTenant(ctx, queue, "a", []byte("a4"))
+
+		if tenant, m, err := d.ReadTenant(ctx, queue, nil); err != nil || tenant != "a" || string(m) != "a4" {
+			t.Errorf("Expected ReadTenant() to return a:a4, got %s:%s, %v", tenant, m, err)
+		}
+
+		_ = d.Ack(ctx, queue, []byte("a4"))
+	})
+
+	t.Run("it_should_count_backlogs_of_every_priority_level", func(t *testing.T) {
+		expect := map[string]int64{"a": 1}
+
+		if got, err := d.GetStats(ctx); err != nil || !reflect.DeepEqual((*got)["test-queue"].TenantBacklogs, expect) {
+			t.Errorf("Expected GetStats() to return backlogs %v, got %v, %v", expect, got, err)
+		}
+	})
+
+	t.Run("it_should_promote_scheduled_message_back_to_its_tenant", func(t *testing.T) {
+		m := []byte(`{"id":"scheduled","tenant_key":"b"}`)
+		_ = d.Schedule(ctx, queue, m, time.Now())
+
+		if n, err := d.Promote(ctx, queue, time.Now()); err != nil || n != 1 {
+			t.Errorf("Expected Promote() to promote 1 message, got %v, %v", n, err)
+		}
+
+		if tenant, got, err := d.ReadTenant(ctx, queue, nil); err != nil || tenant != "b" || string(got) != string(m) {
+			t.Errorf("Expected ReadTenant() to return promoted message of tenant b, got %s:%s, %v", tenant, got, err)
+		}
+	})
+}
+
+func TestRedisQueueDriver_GetStats(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r)
+
+	t.Run("it_should_return_queue_stats", func(t *testing.T) {
+		_ = d.Register(context.Background(), "test-queue")
+		_ = d.SetProcessed(context.Background(), "simple-queue:data:test-queue")
+		_ = d.SetFailed(context.Background(), "simple-queue:data:test-queue", "test-id")
+		_ = d.SetExpired(context.Background(), "simple-queue:data:test-queue")
+
+		expect := &Stats{"test-queue": Stat{Processed: 1, Expired: 1, Failed: 1, FailedIDs: []string{"test-id"}}}
+
+		if got, err := d.GetStats(context.Background()); err != nil || !reflect.DeepEqual(expect, got) {
+			t.Errorf("Expected GetStats() to return %v, got %v, %v", expect, got, err)
+		}
+	})
+}
+
+func TestRedisQueueDriver_listMode(t *testing.T) {
+	_, r := newTestRedis(t)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_read_messages_in_order", func(t *testing.T) {
+		d := NewRedisQueueDriver(r, WithRedisMode(RedisModeList))
+
+		for _, m := range []string{"a", "b", "a", "c"} {
+			_ = d.Write(context.Background(), queue, []byte(m))
+		}
+
+		for _, expect := range []string{"a", "b", "a", "c"} {
+			if got, err := d.Read(context.Background(), queue); err != nil || string(got) != expect {
+				t.Errorf("Expected Read() to return %s, got %s, %v", expect, got, err)
+			}
+		}
+	})
+
+	t.Run("it_should_drop_pending_duplicates_when_asked", func(t *testing.T) {
+		d := NewRedisQueueDriver(r, WithRedisMode(RedisModeList), WithRedisDedup())
+
+		_ = d.Write(context.Background(), queue, []byte("a"))
+		_ = d.Write(context.Background(), queue, []byte("a"))
+
+		if got := r.LLen(d.listKey(queue)).Val(); got != 1 {
+			t.Errorf("Expected list to contain 1 message, got %v", got)
+		}
+
+		_, _ = d.Read(context.Background(), queue)
+		_ = d.Write(context.Background(), queue, []byte("a"))
+
+		if got := r.LLen(d.listKey(queue)).Val(); got != 1 {
+			t.Errorf("Expected read message to be written again, got %v messages", got)
+		}
+	})
+
+	t.Run("it_should_return_nacked_message_to_the_head_of_the_queue", func(t *testing.T) {
+		r.FlushAll()
+		d := NewRedisQueueDriver(r, WithRedisMode(RedisModeList))
+
+		_ = d.Write(context.Background(), queue, []byte("a"))
+		_ = d.Write(context.Background(), queue, []byte("b"))
+
+		m, _ := d.Read(context.Background(), queue)
+		_ = d.Nack(context.Background(), queue, m)
+
+		if got, _ := d.Read(context.Background(), queue); string(got) != "a" {
+			t.Errorf("Expected Read() to return a, got %s", got)
+		}
+	})
+
+	t.Run("it_should_read_messages_stored_in_set_layout", func(t *testing.T) {
+		r.FlushAll()
+		_ = NewRedisQueueDriver(r).Write(context.Background(), queue, []byte("legacy"))
+
+		if got, _ := NewRedisQueueDriver(r, WithRedisMode(RedisModeList)).Read(context.Background(), queue); string(got) != "legacy" {
+			t.Errorf("Expected Read() to return legacy, got %s", got)
+		}
+	})
+}
+
+func TestRedisQueueDriver_MigrateSetToList(t *testing.T) {
+	_, r := newTestRedis(t)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_move_set_messages_ahead_of_list_messages", func(t *testing.T) {
+		_ = NewRedisQueueDriver(r).Write(context.Background(), queue, []byte("legacy"))
+
+		d := NewRedisQueueDriver(r, WithRedisMode(RedisModeList))
+		_ = d.Write(context.Background(), queue, []byte("new"))
+
+		if n, err := d.MigrateSetToList(context.Background(), queue); err != nil || n != 1 {
+			t.Errorf("Expected MigrateSetToList() to migrate 1 message, got %v, %v", n, err)
+		}
+
+		for _, expect := range []string{"legacy", "new"} {
+			if got, _ := d.Read(context.Background(), queue); string(got) != expect {
+				t.Errorf("Expected Read() to return %s, got %s", expect, got)
+			}
+		}
+	})
+}
+
+func TestRedisQueueDriver_Promote(t *testing.T) {
+	_, r := newTestRedis(t)
+	queue := "simple-queue:data:active:test-queue"
+	now := time.Now()
+
+	for _, mode := range []RedisMode{RedisModeSet, RedisModeList} {
+		d := NewRedisQueueDriver(r, WithRedisMode(mode))
+
+		t.Run(fmt.Sprintf("it_should_move_due_messages_to_queue_in_mode_%d", mode), func(t *testing.T) {
+			_ = d.Schedule(context.Background(), queue, []byte("due"), now.Add(-time.Second))
+			_ = d.Schedule(context.Background(), queue, []byte("later"), now.Add(time.Hour))
+
+			if n, err := d.Promote(context.Background(), queue, now); err != nil || n != 1 {
+				t.Errorf("Expected Promote() to promote 1 message, got %v, %v", n, err)
+			}
+
+			if got, _ := d.Read(context.Background(), queue); string(got) != "due" {
+				t.Errorf("Expected Read() to return due, got %s", got)
+			}
+
+			if _, err := d.Read(context.Background(), queue); err != redis.Nil {
+				t.Errorf("Expected Read() to return %v, got %v", redis.Nil, err)
+			}
+
+			r.FlushAll()
+		})
+	}
+}
+
+func TestRedisQueueDriver_Reschedule(t *testing.T) {
+	_, r := newTestRedis(t)
+	queue := "simple-queue:data:active:test-queue"
+	now := time.Now()
+
+	for _, mode := range []RedisMode{RedisModeSet, RedisModeList} {
+		d := NewRedisQueueDriver(r, WithRedisMode(mode))
+
+		t.Run(fmt.Sprintf("it_should_reschedule_pending_message_in_mode_%d", mode), func(t *testing.T) {
+			_ = d.Write(context.Background(), queue, []byte(`{"id":"pending"}`))
+
+			if err := d.Reschedule(context.Background(), queue, "pending", now.Add(time.Hour)); err != nil {
+				t.Errorf("Expected Reschedule() not to return error, got %v", err)
+			}
+
+			if _, err := d.Read(context.Background(), queue); err != redis.Nil {
+				t.Errorf("Expected rescheduled message to leave the queue, got %v", err)
+			}
+
+			if n, _ := d.Promote(context.Background(), queue, now.Add(time.Hour)); n != 1 {
+				t.Errorf("Expected rescheduled message to be promoted")
+			}
+
+			r.FlushAll()
+		})
+	}
+
+	t.Run("it_should_move_scheduled_message", func(t *testing.T) {
+		d := NewRedisQueueDriver(r)
+		_ = d.Schedule(context.Background(), queue, []byte(`{"id":"scheduled"}`), now.Add(time.Hour))
+
+		if err := d.Reschedule(context.Background(), queue, "scheduled", now.Add(-time.Second)); err != nil {
+			t.Errorf("Expected Reschedule() not to return error, got %v", err)
+		}
+
+		if n, _ := d.Promote(context.Background(), queue, now); n != 1 {
+			t.Errorf("Expected rescheduled message to be due")
+		}
+	})
+
+	t.Run("it_should_return_error_when_message_has_been_read", func(t *testing.T) {
+		r.FlushAll()
+		d := NewRedisQueueDriver(r)
+		_ = d.Write(context.Background(), queue, []byte(`{"id":"read"}`))
+		_, _ = d.Read(context.Background(), queue)
+
+		if err := d.Reschedule(context.Background(), queue, "read", now); err != ErrMessageNotFound {
+			t.Errorf("Expected Reschedule() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+	})
+}
+
+func TestRedisQueueDriver_Delete(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r)
+	queue := "simple-queue:data:active:test-queue"
+
+	t.Run("it_should_delete_scheduled_message", func(t *testing.T) {
+		_ = d.Schedule(context.Background(), queue, []byte(`{"id":"scheduled"}`), time.Now())
+
+		if _, err := d.Delete(context.Background(), queue, "scheduled"); err != nil {
+			t.Errorf("Expected Delete() not to return error, got %v", err)
+		}
+
+		if n, _ := d.Promote(context.Background(), queue, time.Now()); n != 0 {
+			t.Errorf("Expected deleted message not to be promoted")
+		}
+	})
+
+	t.Run("it_should_return_error_when_message_does_not_exist", func(t *testing.T) {
+		if _, err := d.Delete(context.Background(), queue, "unknown"); err != ErrMessageNotFound {
+			t.Errorf("Expected Delete() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+	})
+
+	t.Run("it_should_keep_message_indexed_until_it_is_acked", func(t *testing.T) {
+		m := []byte(`{"id":"acked"}`)
+		_ = d.Write(context.Background(), queue, m)
+		_, _ = d.Read(context.Background(), queue)
+		_ = d.Nack(context.Background(), queue, m)
+
+		if err := d.Reschedule(context.Background(), queue, "acked", time.Now()); err != nil {
+			t.Errorf("Expected Reschedule() to find nacked message, got %v", err)
+		}
+
+		_, _ = d.Promote(context.Background(), queue, time.Now())
+		_, _ = d.Read(context.Background(), queue)
+		_ = d.Ack(context.Background(), queue, m)
+
+		if got := r.HLen(idsKey(queue)).Val(); got != 0 {
+			t.Errorf("Expected acked message not to be indexed, got %v entries", got)
+		}
+	})
+
+	t.Run("it_should_delete_pending_grouped_message", func(t *testing.T) {
+		m := []byte(`{"id":"grouped","group_key":"a"}`)
+		_ = d.WriteGroup(context.Background(), queue, "a", m)
+
+		if err := d.Reschedule(context.Background(), queue, "grouped", time.Now()); !errors.Is(err, ErrGroupedMessage) {
+			t.Errorf("Expected Reschedule() to return error %v, got %v", ErrGroupedMessage, err)
+		}
+
+		if got, err := d.Delete(context.Background(), queue, "grouped"); err != nil || string(got) != string(m) {
+			t.Errorf("Expected Delete() to return deleted message, got %s, %v", got, err)
+		}
+
+		if _, _, err := d.ReadGroup(context.Background(), queue, time.Hour); err != redis.Nil {
+			t.Errorf("Expected ReadGroup() to return redis.Nil once grouped message was deleted, got %v", err)
+		}
+	})
+
+	t.Run("it_should_delete_pending_tenant_message", func(t *testing.T) {
+		m := []byte(`{"id":"tenanted","tenant_key":"a"}`)
+		_ = d.WriteTenant(context.Background(), queue, "a", m)
+
+		if got, err := d.Delete(context.Background(), queue, "tenanted"); err != nil || string(got) != string(m) {
+			t.Errorf("Expected Delete() to return deleted message, got %s, %v", got, err)
+		}
+
+		if n := r.LLen(tenantsReadyKey(queue)).Val(); n != 0 || r.HLen(tenantsKey(queue)).Val() != 0 {
+			t.Errorf("Expected tenant without pending messages to leave ready tenants, got %v", n)
+		}
+	})
+}
+
+func TestRedisQueueDriver_DeadLetters(t *testing.T) {
+	_, r := newTestRedis(t)
+	d := NewRedisQueueDriver(r)
+	queue := "simple-queue:data:test-queue"
+
+	t.Run("it_should_keep_dead_letters", func(t *testing.T) {
+		_ = d.AddDeadLetter(context.Background(), queue, "test-id", []byte("test-data"))
+
+		if got, err := d.GetDeadLetters(context.Background(), queue); err != nil || !reflect.DeepEqual(got, [][]byte{[]byte("test-data")}) {
+			t.Errorf("Expected GetDeadLetters() to return test-data, got %s, %v", got, err)
+		}
+
+		if got, err := d.GetDeadLetter(context.Background(), queue, "test-id"); err != nil || string(got) != "test-data" {
+			t.Errorf("Expected GetDeadLetter() to return test-data, got %s, %v", got, err)
+		}
+	})
+
+	t.Run("it_should_delete_dead_letter", func(t *testing.T) {
+		if err := d.DeleteDeadLetter(context.Background(), queue, "test-id"); err != nil {
+			t.Errorf("Expected DeleteDeadLetter() not to return error, got %v", err)
+		}
+
+		if _, err := d.GetDeadLetter(context.Background(), queue, "test-id"); err != ErrMessageNotFound {
+			t.Errorf("Expected GetDeadLetter() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+
+		if err := d.DeleteDeadLetter(context.Background(), queue, "test-id"); err != ErrMessageNotFound {
+			t.Errorf("Expected DeleteDeadLetter() to return error %v, got %v", ErrMessageNotFound, err)
+		}
+	})
+}
@@ -7,5 +7,8 @@ type Stats map[string]Stat
 type Stat struct {
 	Failed    int
 	Processed int64
+	Expired   int64
 	FailedIDs []string
+	// TenantBacklogs is the number of pending messages of each tenant of a queue with fair dispatch
+	TenantBacklogs map[string]int64
 }